@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"go.seankhliao.com/gomodstats/v2/pb"
+)
+
+// Aggregator is a report built from a single pass over the dataset,
+// it should also implement one or more of
+// RecordAggregator, ModuleAggregator, SelectedAggregator
+// to receive data
+type Aggregator interface {
+	Name() string
+	// Write outputs the report once all data has been seen
+	Write() error
+}
+
+// RecordAggregator receives every index record, in index order
+type RecordAggregator interface {
+	Aggregator
+	Record(ir *pb.IndexRecord) error
+}
+
+// ModuleAggregator receives every module path with its index records in semver order
+type ModuleAggregator interface {
+	Aggregator
+	Module(m string, irs []*pb.IndexRecord) error
+}
+
+// SelectedAggregator receives the stored results for the versions of every module
+// picked by the selection policy, see selectVersions.
+// Versions without stored results are skipped
+type SelectedAggregator interface {
+	Aggregator
+	Selected(ir *pb.IndexRecord, mv *pb.ModuleVersion) error
+}
+
+var aggregatorNames []string
+var aggregatorFuncs = make(map[string]func() (Aggregator, error))
+
+// RegisterAggregator makes an aggregator available by name,
+// newAgg is called after flags are parsed and should reject bad flag values
+func RegisterAggregator(name string, newAgg func() (Aggregator, error)) {
+	if _, ok := aggregatorFuncs[name]; !ok {
+		aggregatorNames = append(aggregatorNames, name)
+	}
+	aggregatorFuncs[name] = newAgg
+}
+
+func init() {
+	RegisterAggregator("timeofday", func() (Aggregator, error) { return &timeofdayAggregator{}, nil })
+	RegisterAggregator("weekhour", func() (Aggregator, error) { return newWeekhourAggregator(*groupBy) })
+	RegisterAggregator("timeseries", func() (Aggregator, error) { return newTimeseriesAggregator(*interval, *groupBy) })
+	RegisterAggregator("latest", func() (Aggregator, error) { return newLatestAggregator(), nil })
+	RegisterAggregator("versions", func() (Aggregator, error) { return newVersionsAggregator(), nil })
+	RegisterAggregator("hygiene", func() (Aggregator, error) { return newHygieneAggregator(), nil })
+	RegisterAggregator("majors", func() (Aggregator, error) { return newMajorsAggregator(), nil })
+	RegisterAggregator("hosting", func() (Aggregator, error) { return newHostingAggregator(goimportResolver()), nil })
+	RegisterAggregator("owners", func() (Aggregator, error) { return newOwnersAggregator(goimportResolver()), nil })
+	RegisterAggregator("monorepos", func() (Aggregator, error) { return newMonoreposAggregator(goimportResolver()), nil })
+	RegisterAggregator("lifecycle", func() (Aggregator, error) { return newLifecycleAggregator(*abandoned), nil })
+	RegisterAggregator("gone", func() (Aggregator, error) { return newGoneAggregator() })
+	RegisterAggregator("histogram", func() (Aggregator, error) { return newHistogramAggregator(*metrics, *binning, *nbins) })
+}
+
+var goimports *resolver
+
+// goimportResolver is shared by the hosting reports so each go-import page
+// is read once per run, aggregation is serial so it needs no locking
+func goimportResolver() *resolver {
+	if goimports == nil {
+		goimports = newResolver(*goimportDir, *goimportURL)
+	}
+	return goimports
+}
+
+// aggregators creates the named aggregators, all for "all"
+func aggregators(names string) ([]Aggregator, error) {
+	ns := strings.Split(names, ",")
+	if names == "all" {
+		ns = aggregatorNames
+	}
+	aggs := make([]Aggregator, 0, len(ns))
+	for _, n := range ns {
+		newAgg, ok := aggregatorFuncs[n]
+		if !ok {
+			return nil, fmt.Errorf("aggregators: unknown %q, have %s", n, strings.Join(aggregatorNames, ","))
+		}
+		a, err := newAgg()
+		if err != nil {
+			return nil, fmt.Errorf("aggregators %s: %w", n, err)
+		}
+		aggs = append(aggs, a)
+	}
+	return aggs, nil
+}
+
+// aggregate feeds the index and stored module versions to the aggregators in one pass,
+// stored results are only read if an aggregator asks for them.
+// policy picks the versions given to SelectedAggregators
+func aggregate(pbi *pb.Index, aggs []Aggregator, policy string) error {
+	var recs []RecordAggregator
+	var mods []ModuleAggregator
+	var sels []SelectedAggregator
+	for _, a := range aggs {
+		if ra, ok := a.(RecordAggregator); ok {
+			recs = append(recs, ra)
+		}
+		if ma, ok := a.(ModuleAggregator); ok {
+			mods = append(mods, ma)
+		}
+		if sa, ok := a.(SelectedAggregator); ok {
+			sels = append(sels, sa)
+		}
+	}
+	if _, err := selectVersions(nil, policy); err != nil {
+		return fmt.Errorf("aggregate: %w", err)
+	}
+
+	for _, ir := range pbi.Records {
+		for _, a := range recs {
+			err := a.Record(ir)
+			if err != nil {
+				return fmt.Errorf("aggregate %s: %w", a.Name(), err)
+			}
+		}
+	}
+
+	if len(mods)+len(sels) > 0 {
+		idx := groupIndex(pbi)
+		ms := make([]string, 0, len(idx))
+		for m := range idx {
+			ms = append(ms, m)
+		}
+		sort.Strings(ms)
+
+		for _, m := range ms {
+			irs := idx[m]
+			for _, a := range mods {
+				err := a.Module(m, irs)
+				if err != nil {
+					return fmt.Errorf("aggregate %s: %w", a.Name(), err)
+				}
+			}
+			if len(sels) == 0 {
+				continue
+			}
+
+			selected, err := selectVersions(irs, policy)
+			if err != nil {
+				return fmt.Errorf("aggregate: %w", err)
+			}
+			for _, ir := range selected {
+				mv, err := loadModuleVersion(ir.Path, ir.Version)
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+				for _, a := range sels {
+					err = a.Selected(ir, mv)
+					if err != nil {
+						return fmt.Errorf("aggregate %s: %w", a.Name(), err)
+					}
+				}
+			}
+		}
+	}
+
+	for _, a := range aggs {
+		err := a.Write()
+		if err != nil {
+			return fmt.Errorf("aggregate %s: %w", a.Name(), err)
+		}
+	}
+	return nil
+}
+
+// dependents counts distinct dependent modules per required module path,
+// fed the requires of selected versions in module order
+type dependents struct {
+	last  map[string]string
+	count map[string]int64
+}
+
+func newDependents() dependents {
+	return dependents{
+		last:  make(map[string]string),
+		count: make(map[string]int64),
+	}
+}
+
+func (d dependents) add(ir *pb.IndexRecord, mv *pb.ModuleVersion) {
+	for _, r := range mv.Requires {
+		if d.last[r.Version.Module] != ir.Path {
+			d.last[r.Version.Module] = ir.Path
+			d.count[r.Version.Module]++
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+// TestAggregatorInputs catches aggregators that no longer implement
+// the interface for the data they want after a method signature change
+func TestAggregatorInputs(t *testing.T) {
+	for _, name := range aggregatorNames {
+		aggs, err := aggregators(name)
+		if err != nil {
+			t.Errorf("aggregators(%s): %v", name, err)
+			continue
+		}
+		for _, a := range aggs {
+			_, rec := a.(RecordAggregator)
+			_, mod := a.(ModuleAggregator)
+			_, sel := a.(SelectedAggregator)
+			if !rec && !mod && !sel {
+				t.Errorf("%s receives no records, modules or selected versions", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"path/filepath"
+	"strings"
+
+	"go.seankhliao.com/gomodstats/v2/pb"
+	"golang.org/x/mod/modfile"
+)
+
+// Analyzer is a pass over a single module version,
+// run by getMod once the go.mod is parsed and the module zip downloaded.
+// Analyzers write into res, either into its own fields
+// or into res.Analyses keyed by Name, see Result
+type Analyzer interface {
+	Name() string
+	Analyze(m, v string, mf *modfile.File, files Files, res *pb.ModuleVersion) error
+}
+
+var analyzers []Analyzer
+
+// RegisterAnalyzer adds an analyzer to be run on every module version,
+// in registration order
+func RegisterAnalyzer(a Analyzer) {
+	analyzers = append(analyzers, a)
+}
+
+func init() {
+	RegisterAnalyzer(tokenAnalyzer{})
+}
+
+// Result returns the named analysis in res, creating it if necessary
+func Result(res *pb.ModuleVersion, name string) *pb.Analysis {
+	if res.Analyses == nil {
+		res.Analyses = make(map[string]*pb.Analysis)
+	}
+	a, ok := res.Analyses[name]
+	if !ok {
+		a = &pb.Analysis{
+			Counts: make(map[string]int64),
+			Values: make(map[string]string),
+		}
+		res.Analyses[name] = a
+	}
+	return a
+}
+
+// Files iterates over the files in a module zip,
+// names are relative to the module root
+type Files struct {
+	prefix string
+	r      *zip.Reader
+}
+
+// Names lists all files in the zip
+func (f Files) Names() []string {
+	names := make([]string, 0, len(f.r.File))
+	for _, zf := range f.r.File {
+		names = append(names, strings.TrimPrefix(zf.Name, f.prefix))
+	}
+	return names
+}
+
+// Each calls fn with the contents of every file accepted by match,
+// b is only valid for the duration of the call
+func (f Files) Each(match func(name string) bool, fn func(name string, b []byte) error) error {
+	bufi := pool.Get()
+	buf, ok := bufi.(*bytes.Buffer)
+	if !ok {
+		return fmt.Errorf("buffer assert failed, type=%T", bufi)
+	}
+	defer func() {
+		buf.Reset()
+		pool.Put(buf)
+	}()
+
+	for _, zf := range f.r.File {
+		name := strings.TrimPrefix(zf.Name, f.prefix)
+		if !match(name) {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return fmt.Errorf("open %s: %w", name, err)
+		}
+		buf.Reset()
+		_, err = buf.ReadFrom(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("read %s: %w", name, err)
+		}
+		err = fn(name, buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tokenAnalyzer counts go tokens and identifiers into Tokens and Idents
+type tokenAnalyzer struct{}
+
+func (tokenAnalyzer) Name() string { return "tokens" }
+
+func (tokenAnalyzer) Analyze(m, v string, mf *modfile.File, files Files, res *pb.ModuleVersion) error {
+	res.Tokens = make(map[string]int64, 90)
+	res.Idents = make(map[string]int64, 1000)
+
+	fset := token.NewFileSet()
+	isGo := func(name string) bool {
+		return filepath.Ext(name) == ".go"
+	}
+	return files.Each(isGo, func(name string, b []byte) error {
+		file := fset.AddFile(name, fset.Base(), len(b))
+		var s scanner.Scanner
+		s.Init(file, b, nil, scanner.ScanComments)
+		for {
+			_, tok, lit := s.Scan()
+			if tok == token.EOF {
+				break
+			} else if tok == token.IDENT {
+				res.Idents[lit]++
+			}
+			res.Tokens[tok.String()]++
+		}
+		return nil
+	})
+}
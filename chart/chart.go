@@ -0,0 +1,314 @@
+// Package chart renders simple line and bar charts on linear or log axes as standalone SVG documents.
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+)
+
+// Palette colors series in order
+var Palette = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7"}
+
+const (
+	marginLeft   = 64
+	marginRight  = 16
+	marginTop    = 32
+	marginBottom = 64
+)
+
+// Chart holds the options shared by all chart kinds
+type Chart struct {
+	Title  string
+	XLabel string
+	YLabel string
+	// Width and Height in pixels, default 720x360
+	Width, Height int
+	// Labels names x positions 0, 1, ... for categorical data,
+	// used as tick labels instead of numbers
+	Labels []string
+	// LogX and LogY use log10 axes, points with values <= 0 are left out
+	LogX, LogY bool
+}
+
+// Series is a named line of points
+type Series struct {
+	Name string
+	X, Y []float64
+}
+
+func (c Chart) size() (w, h int) {
+	w, h = c.Width, c.Height
+	if w == 0 {
+		w = 720
+	}
+	if h == 0 {
+		h = 360
+	}
+	return w, h
+}
+
+// Line draws series as lines, with a legend if there is more than one
+func (c Chart) Line(series ...Series) []byte {
+	x, y := newScale(c.LogX && c.Labels == nil), newScale(c.LogY)
+	for _, s := range series {
+		for i := range s.X {
+			if x.valid(s.X[i]) && y.valid(s.Y[i]) {
+				x.add(s.X[i])
+				y.add(s.Y[i])
+			}
+		}
+	}
+	y.add(0)
+
+	var b bytes.Buffer
+	p := c.begin(&b, x, y)
+	for i, s := range series {
+		color := Palette[i%len(Palette)]
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="`, color)
+		sep := ""
+		for j := range s.X {
+			if !x.valid(s.X[j]) || !y.valid(s.Y[j]) {
+				continue
+			}
+			fmt.Fprintf(&b, "%s%.1f,%.1f", sep, p.x(s.X[j]), p.y(s.Y[j]))
+			sep = " "
+		}
+		b.WriteString(`"/>` + "\n")
+		if len(series) > 1 {
+			lx, ly := float64(p.right-150), float64(p.top+12+16*i)
+			fmt.Fprintf(&b, `<rect x="%.0f" y="%.0f" width="10" height="10" fill="%s"/>`+"\n", lx, ly-9, color)
+			fmt.Fprintf(&b, `<text x="%.0f" y="%.0f">%s</text>`+"\n", lx+14, ly, html.EscapeString(s.Name))
+		}
+	}
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
+
+// Bar draws one bar per value, labels are taken from Labels.
+// LogX is ignored
+func (c Chart) Bar(values []float64) []byte {
+	if c.Labels == nil {
+		c.Labels = make([]string, len(values))
+		for i := range values {
+			c.Labels[i] = strconv.Itoa(i)
+		}
+	}
+	x, y := newScale(false), newScale(c.LogY)
+	x.add(-0.5)
+	x.add(float64(len(values)) - 0.5)
+	y.add(0)
+	for _, v := range values {
+		y.add(v)
+	}
+
+	var b bytes.Buffer
+	p := c.begin(&b, x, y)
+	bw := (p.x(1) - p.x(0)) * 0.8
+	base := p.y(y.min)
+	for i, v := range values {
+		if !y.valid(v) {
+			continue
+		}
+		top := p.y(v)
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s</title></rect>`+"\n",
+			p.x(float64(i))-bw/2, top, bw, base-top, Palette[0], html.EscapeString(c.label(i)+": "+format(v)))
+	}
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
+
+func (c Chart) label(i int) string {
+	if i < len(c.Labels) {
+		return c.Labels[i]
+	}
+	return ""
+}
+
+// plot maps data to pixel coordinates
+type plot struct {
+	left, right, top, bottom int
+	xs, ys                   *scale
+}
+
+func (p plot) x(v float64) float64 {
+	return float64(p.left) + p.xs.pos(v)*float64(p.right-p.left)
+}
+
+func (p plot) y(v float64) float64 {
+	return float64(p.bottom) - p.ys.pos(v)*float64(p.bottom-p.top)
+}
+
+// begin writes the svg header, title, axes, ticks and labels
+func (c Chart) begin(b *bytes.Buffer, xs, ys *scale) plot {
+	w, h := c.size()
+	p := plot{
+		left:   marginLeft,
+		right:  w - marginRight,
+		top:    marginTop,
+		bottom: h - marginBottom,
+		xs:     xs,
+		ys:     ys,
+	}
+	for _, s := range []*scale{xs, ys} {
+		if math.IsInf(s.min, 0) {
+			s.min, s.max = 0, 1
+			if s.log {
+				s.min, s.max = 1, 10
+			}
+		}
+	}
+	ys.nice()
+	if c.Labels == nil {
+		xs.nice()
+	}
+
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n", w, h, w, h)
+	fmt.Fprintf(b, `<rect width="%d" height="%d" fill="white"/>`+"\n", w, h)
+	if c.Title != "" {
+		fmt.Fprintf(b, `<text x="%d" y="20" text-anchor="middle" font-size="14">%s</text>`+"\n", w/2, html.EscapeString(c.Title))
+	}
+
+	for _, t := range ys.ticks() {
+		y := p.y(t)
+		fmt.Fprintf(b, `<line x1="%d" x2="%d" y1="%.1f" y2="%.1f" stroke="#ddd"/>`+"\n", p.left, p.right, y, y)
+		fmt.Fprintf(b, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`+"\n", p.left-4, y, format(t))
+	}
+
+	if c.Labels != nil {
+		// at most about 12 labels
+		step := (len(c.Labels) + 11) / 12
+		for i := 0; i < len(c.Labels); i += step {
+			x := p.x(float64(i))
+			fmt.Fprintf(b, `<text x="%.1f" y="%d" text-anchor="end" transform="rotate(-35 %.1f %d)">%s</text>`+"\n",
+				x, p.bottom+14, x, p.bottom+14, html.EscapeString(c.Labels[i]))
+		}
+	} else {
+		for _, t := range xs.ticks() {
+			x := p.x(t)
+			fmt.Fprintf(b, `<line x1="%.1f" x2="%.1f" y1="%d" y2="%d" stroke="#999"/>`+"\n", x, x, p.bottom, p.bottom+4)
+			fmt.Fprintf(b, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n", x, p.bottom+16, format(t))
+		}
+	}
+
+	fmt.Fprintf(b, `<line x1="%d" x2="%d" y1="%d" y2="%d" stroke="#333"/>`+"\n", p.left, p.right, p.bottom, p.bottom)
+	fmt.Fprintf(b, `<line x1="%d" x2="%d" y1="%d" y2="%d" stroke="#333"/>`+"\n", p.left, p.left, p.top, p.bottom)
+	if c.XLabel != "" {
+		fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n", (p.left+p.right)/2, h-6, html.EscapeString(c.XLabel))
+	}
+	if c.YLabel != "" {
+		fmt.Fprintf(b, `<text x="14" y="%d" text-anchor="middle" transform="rotate(-90 14 %d)">%s</text>`+"\n", (p.top+p.bottom)/2, (p.top+p.bottom)/2, html.EscapeString(c.YLabel))
+	}
+	return p
+}
+
+// scale is a linear or log10 axis over the range of the values added
+type scale struct {
+	min, max float64
+	log      bool
+	// tick interval, set by nice
+	st float64
+}
+
+func newScale(log bool) *scale {
+	return &scale{min: math.Inf(1), max: math.Inf(-1), log: log}
+}
+
+// valid reports whether v can be placed on the scale
+func (s *scale) valid(v float64) bool {
+	return !s.log || v > 0
+}
+
+func (s *scale) add(v float64) {
+	if !s.valid(v) {
+		return
+	}
+	s.min = math.Min(s.min, v)
+	s.max = math.Max(s.max, v)
+}
+
+// pos is the position of v in [0, 1]
+func (s *scale) pos(v float64) float64 {
+	if s.max == s.min {
+		return 0.5
+	}
+	if s.log {
+		return (math.Log10(v) - math.Log10(s.min)) / (math.Log10(s.max) - math.Log10(s.min))
+	}
+	return (v - s.min) / (s.max - s.min)
+}
+
+// step is a round tick interval giving about 5 ticks
+func (s *scale) step() float64 {
+	r := s.max - s.min
+	if r <= 0 || math.IsInf(r, 0) || math.IsNaN(r) {
+		return 1
+	}
+	raw := r / 5
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if m*mag >= raw {
+			return m * mag
+		}
+	}
+	return 10 * mag
+}
+
+// nice widens the range to round tick values, powers of 10 for log scales
+func (s *scale) nice() {
+	if s.log {
+		s.min = math.Pow(10, math.Floor(math.Log10(s.min)))
+		s.max = math.Pow(10, math.Ceil(math.Log10(s.max)))
+		if s.max == s.min {
+			s.max *= 10
+		}
+		return
+	}
+	st := s.step()
+	s.min = math.Floor(s.min/st) * st
+	s.max = math.Ceil(s.max/st) * st
+	if s.max == s.min {
+		s.max += st
+	}
+	s.st = st
+}
+
+func (s *scale) ticks() []float64 {
+	if s.log {
+		var ts []float64
+		for e := math.Floor(math.Log10(s.min)); e <= math.Log10(s.max)+0.5; e++ {
+			ts = append(ts, math.Pow(10, e))
+		}
+		return ts
+	}
+	st := s.st
+	if st == 0 {
+		st = s.step()
+	}
+	var ts []float64
+	for t := s.min; t <= s.max+st/2; t += st {
+		ts = append(ts, math.Round(t/st)*st)
+	}
+	return ts
+}
+
+// format shortens large numbers with k, M, G suffixes
+func format(v float64) string {
+	a := math.Abs(v)
+	switch {
+	case a >= 1e9:
+		return round(v/1e9, 10) + "G"
+	case a >= 1e6:
+		return round(v/1e6, 10) + "M"
+	case a >= 1e4:
+		return round(v/1e3, 10) + "k"
+	}
+	return round(v, 100)
+}
+
+// round to 1/d
+func round(v, d float64) string {
+	return strconv.FormatFloat(math.Round(v*d)/d, 'f', -1, 64)
+}
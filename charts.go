@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"go.seankhliao.com/gomodstats/v2/chart"
+)
+
+const (
+	// maxSeries is the most keys drawn as lines in a time series chart
+	maxSeries = 8
+	// maxBars is the most bars in a chart, more rows are drawn as a line
+	// or, for unordered keys, cut to the largest counts
+	maxBars = 40
+)
+
+// tableChart draws tables with a count column as svg, nil for others:
+//   - time series (bucket, key, count) as a line for each of the largest keys
+//   - histograms (lower, upper, count) as bars
+//   - integer keys as bars, or a line if there are many,
+//     on log-log axes if they span more than 2 orders of magnitude
+//   - times of day as a line
+//   - other keys as bars of the largest counts
+func tableChart(t table) []byte {
+	names, types := t.columns()
+	ci := -1
+	for i, n := range names {
+		if n == "count" && types[i] != "string" {
+			ci = i
+			break
+		}
+	}
+	if ci < 1 || len(t.rows) == 0 {
+		return nil
+	}
+	c := chart.Chart{Title: t.name, XLabel: names[0], YLabel: names[ci]}
+	values := make([]float64, len(t.rows))
+	for i, row := range t.rows {
+		values[i], _ = strconv.ParseFloat(row[ci], 64)
+	}
+
+	switch {
+	case ci == 2 && names[1] == "key" && types[1] == "string":
+		return seriesChart(c, t.rows)
+
+	case ci == 2 && names[0] == "lower" && names[1] == "upper":
+		for _, row := range t.rows {
+			c.Labels = append(c.Labels, row[0]+"–"+row[1])
+		}
+		return barOrLine(c, values)
+
+	case intKeys(t.rows):
+		if len(t.rows) <= maxBars {
+			for _, row := range t.rows {
+				c.Labels = append(c.Labels, row[0])
+			}
+			return c.Bar(values)
+		}
+		s := chart.Series{Name: t.name, Y: values}
+		min, max := math.Inf(1), math.Inf(-1)
+		for _, row := range t.rows {
+			x, _ := strconv.ParseFloat(row[0], 64)
+			s.X = append(s.X, x)
+			if x > 0 {
+				min, max = math.Min(min, x), math.Max(max, x)
+			}
+		}
+		if max >= 100*min {
+			c.LogX, c.LogY = true, true
+		}
+		// -sort value leaves keys out of order
+		sort.Sort(byX(s))
+		return c.Line(s)
+
+	case names[0] == "time":
+		for _, row := range t.rows {
+			c.Labels = append(c.Labels, row[0])
+		}
+		return barOrLine(c, values)
+	}
+
+	idx := make([]int, len(t.rows))
+	for i := range idx {
+		idx[i] = i
+	}
+	if len(idx) > maxBars {
+		sort.SliceStable(idx, func(i, j int) bool {
+			return values[idx[i]] > values[idx[j]]
+		})
+		c.Title = fmt.Sprintf("%s (top %d of %d)", t.name, maxBars, len(idx))
+		idx = idx[:maxBars]
+	}
+	bars := make([]float64, len(idx))
+	for i, j := range idx {
+		c.Labels = append(c.Labels, t.rows[j][0])
+		bars[i] = values[j]
+	}
+	return c.Bar(bars)
+}
+
+// barOrLine draws values in order as bars, or as a line if there are many
+func barOrLine(c chart.Chart, values []float64) []byte {
+	if len(values) <= maxBars {
+		return c.Bar(values)
+	}
+	xs := make([]float64, len(values))
+	for i := range xs {
+		xs[i] = float64(i)
+	}
+	return c.Line(chart.Series{Name: c.Title, X: xs, Y: values})
+}
+
+// byX orders the points of a series by x
+type byX chart.Series
+
+func (s byX) Len() int           { return len(s.X) }
+func (s byX) Less(i, j int) bool { return s.X[i] < s.X[j] }
+func (s byX) Swap(i, j int) {
+	s.X[i], s.X[j] = s.X[j], s.X[i]
+	s.Y[i], s.Y[j] = s.Y[j], s.Y[i]
+}
+
+// intKeys reports whether the first column is all integers
+func intKeys(rows [][]string) bool {
+	for _, row := range rows {
+		if _, err := strconv.ParseInt(row[0], 10, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// seriesChart draws bucket, key, count rows as a line per key
+func seriesChart(c chart.Chart, rows [][]string) []byte {
+	buckets := make(map[string]int)
+	counts := make(map[string]map[string]float64)
+	totals := make(map[string]float64)
+	for _, row := range rows {
+		v, _ := strconv.ParseFloat(row[2], 64)
+		buckets[row[0]] = 0
+		if counts[row[1]] == nil {
+			counts[row[1]] = make(map[string]float64)
+		}
+		counts[row[1]][row[0]] += v
+		totals[row[1]] += v
+	}
+	for b := range buckets {
+		c.Labels = append(c.Labels, b)
+	}
+	// bucket formats sort chronologically
+	sort.Strings(c.Labels)
+	for i, b := range c.Labels {
+		buckets[b] = i
+	}
+
+	keys := make([]string, 0, len(totals))
+	for k := range totals {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if totals[keys[i]] != totals[keys[j]] {
+			return totals[keys[i]] > totals[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > maxSeries {
+		keys = keys[:maxSeries]
+	}
+
+	series := make([]chart.Series, 0, len(keys))
+	for _, k := range keys {
+		s := chart.Series{Name: k, X: make([]float64, len(c.Labels)), Y: make([]float64, len(c.Labels))}
+		for i := range s.X {
+			s.X[i] = float64(i)
+		}
+		for b, v := range counts[k] {
+			s.Y[buckets[b]] = v
+		}
+		if s.Name == "" {
+			s.Name = "all"
+		}
+		series = append(series, s)
+	}
+	return c.Line(series...)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.seankhliao.com/gomodstats/v2/pb"
+)
+
+// snapshot is the index, gone records and selected version aggregates
+// of one dataset directory
+type snapshot struct {
+	idx    map[string][]*pb.IndexRecord
+	gone   map[string]string
+	govers map[string]int64
+	idents map[string]int64
+	tokens map[string]int64
+}
+
+// readSnapshot reads a dataset directory, keeping index and gone records up to day like asOf
+func readSnapshot(dir, policy string, day time.Time) (*snapshot, error) {
+	pbi, err := readIndex(dir)
+	if err != nil {
+		return nil, fmt.Errorf("readSnapshot: %w", err)
+	}
+	pbi = asOf(pbi, day)
+	pbg, err := readGone(dir)
+	if err != nil {
+		return nil, fmt.Errorf("readSnapshot: %w", err)
+	}
+	pbg = goneAsOf(pbg, day)
+	s := &snapshot{
+		idx:    groupIndex(pbi),
+		gone:   make(map[string]string, len(pbg.Records)),
+		govers: make(map[string]int64),
+		idents: make(map[string]int64),
+		tokens: make(map[string]int64),
+	}
+	for _, gr := range pbg.Records {
+		if _, ok := s.gone[gr.Path+"@"+gr.Version]; !ok {
+			s.gone[gr.Path+"@"+gr.Version] = gr.Observed
+		}
+	}
+	for m, irs := range s.idx {
+		selected, err := selectVersions(irs, policy)
+		if err != nil {
+			return nil, fmt.Errorf("readSnapshot: %w", err)
+		}
+		for _, ir := range selected {
+			mv, err := readModuleVersion(dir, m, ir.Version)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			s.govers[mv.Go]++
+			for k, c := range mv.Idents {
+				s.idents[k] += c
+			}
+			for k, c := range mv.Tokens {
+				s.tokens[k] += c
+			}
+		}
+	}
+	return s, nil
+}
+
+// diff compares two dataset directories, each holding index.pb, gone.pb and mods/,
+// both cut off at -asof,
+// reporting what was added in the newer one
+// and how the top identifier and token rankings moved
+func diff(olddir, newdir string, top int, policy string) {
+	o, err := readSnapshot(olddir, policy, asof.Time)
+	if err != nil {
+		log.Fatal(err)
+	}
+	n, err := readSnapshot(newdir, policy, asof.Time)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var mods, vers, gones [][]string
+	for m, irs := range n.idx {
+		oirs, ok := o.idx[m]
+		if !ok {
+			// irs are in semver order, the first published can be any of them
+			first := irs[0]
+			for _, ir := range irs[1:] {
+				if publishTime(ir).Before(publishTime(first)) {
+					first = ir
+				}
+			}
+			mods = append(mods, []string{m, strconv.Itoa(len(irs)), first.Timestamp})
+		}
+		seen := make(map[string]bool, len(oirs))
+		for _, ir := range oirs {
+			seen[ir.Version] = true
+		}
+		for _, ir := range irs {
+			if !seen[ir.Version] {
+				vers = append(vers, []string{m, ir.Version, ir.Timestamp})
+			}
+		}
+	}
+	for mod, observed := range n.gone {
+		if _, ok := o.gone[mod]; !ok {
+			gones = append(gones, []string{mod, observed})
+		}
+	}
+	for _, rows := range [][][]string{mods, vers, gones} {
+		sort.Slice(rows, func(i, j int) bool {
+			if rows[i][0] != rows[j][0] {
+				return rows[i][0] < rows[j][0]
+			}
+			return rows[i][1] < rows[j][1]
+		})
+	}
+
+	log.Printf("diff modules=%d versions=%d gone=%d", len(mods), len(vers), len(gones))
+	for _, t := range []table{
+		{name: "diff-modules", header: []string{"module", "versions:int", "first"}, rows: mods},
+		{name: "diff-versions", header: []string{"module", "version", "timestamp"}, rows: vers},
+		{name: "diff-gone", header: []string{"module", "observed"}, rows: gones},
+		{name: "diff-govers", header: []string{"go", "old:int", "new:int", "delta:int"}, rows: diffCounts(o.govers, n.govers)},
+		{name: "diff-idents", header: []string{"ident", "oldrank:int", "newrank:int", "rise:int", "old:int", "new:int"}, rows: diffRanks(o.idents, n.idents, top)},
+		{name: "diff-tokens", header: []string{"token", "oldrank:int", "newrank:int", "rise:int", "old:int", "new:int"}, rows: diffRanks(o.tokens, n.tokens, top)},
+	} {
+		err = writeOutput(t)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// diffCounts lines up two count maps by key
+func diffCounts(o, n map[string]int64) [][]string {
+	keys := make(map[string]bool)
+	for k := range o {
+		keys[k] = true
+	}
+	for k := range n {
+		keys[k] = true
+	}
+	rows := make([][]string, 0, len(keys))
+	for k := range keys {
+		rows = append(rows, []string{k, strconv.FormatInt(o[k], 10), strconv.FormatInt(n[k], 10), strconv.FormatInt(n[k]-o[k], 10)})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i][0] < rows[j][0]
+	})
+	return rows
+}
+
+// diffRanks compares the top entries of two count maps,
+// keys in the top of either are included, in new rank order,
+// unranked keys have an empty rank
+func diffRanks(o, n map[string]int64, top int) [][]string {
+	orank, nrank := rank(o), rank(n)
+	seen := make(map[string]bool)
+	var keys []string
+	for _, ranks := range []map[string]int{nrank, orank} {
+		for k, r := range ranks {
+			if r <= top && !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	// keys missing from the new ranking go last, in old rank order
+	order := func(k string) int {
+		if nrank[k] == 0 {
+			return len(nrank) + orank[k]
+		}
+		return nrank[k]
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return order(keys[i]) < order(keys[j])
+	})
+
+	rows := make([][]string, 0, len(keys))
+	for _, k := range keys {
+		var or, nr, rise string
+		if orank[k] > 0 {
+			or = strconv.Itoa(orank[k])
+		}
+		if nrank[k] > 0 {
+			nr = strconv.Itoa(nrank[k])
+		}
+		if orank[k] > 0 && nrank[k] > 0 {
+			rise = strconv.Itoa(orank[k] - nrank[k])
+		}
+		rows = append(rows, []string{k, or, nr, rise, strconv.FormatInt(o[k], 10), strconv.FormatInt(n[k], 10)})
+	}
+	return rows
+}
+
+// rank numbers keys from 1 by descending count
+func rank(m map[string]int64) map[string]int {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	r := make(map[string]int, len(keys))
+	for i, k := range keys {
+		r[k] = i + 1
+	}
+	return r
+}
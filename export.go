@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go.seankhliao.com/gomodstats/v2/parquet"
+	"go.seankhliao.com/gomodstats/v2/pb"
+	"go.seankhliao.com/gomodstats/v2/sqlite"
+)
+
+// export writes the dataset in another format: sqlite or parquet
+func export(format, fn, policy string) {
+	var agg Aggregator
+	var err error
+	switch format {
+	case "sqlite":
+		if fn == "" {
+			fn = "gomodstats.db"
+		}
+		agg, err = newSqliteAggregator(fn)
+	case "parquet":
+		if fn == "" {
+			fn = "parquet"
+		}
+		agg, err = newParquetAggregator(fn)
+	default:
+		err = fmt.Errorf("export: unknown format %q", format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pbi, err := Index(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = aggregate(asOf(pbi, asof.Time), []Aggregator{agg}, policy)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// sqliteAggregator writes all index records and the selected module versions
+// into normalized tables:
+//
+//	index_records(id, path, version, timestamp)
+//	module_versions(id, index_record_id, go)
+//	requires(module_version_id, path, version, indirect)
+//	replaces(module_version_id, old_path, old_version, new_path, new_version)
+//	excludes(module_version_id, path, version)
+//	tokens(module_version_id, token, count)
+//	idents(module_version_id, ident, count)
+//
+// module_versions get their path and version by joining on index_records
+type sqliteAggregator struct {
+	db  *sqlite.DB
+	ids map[string]int64
+
+	records  *sqlite.Table
+	versions *sqlite.Table
+	requires *sqlite.Table
+	replaces *sqlite.Table
+	excludes *sqlite.Table
+	tokens   *sqlite.Table
+	idents   *sqlite.Table
+}
+
+func newSqliteAggregator(fn string) (*sqliteAggregator, error) {
+	db, err := sqlite.Create(fn)
+	if err != nil {
+		return nil, fmt.Errorf("newSqliteAggregator: %w", err)
+	}
+	a := &sqliteAggregator{
+		db:  db,
+		ids: make(map[string]int64),
+
+		records:  db.CreateTable("index_records", "id INTEGER PRIMARY KEY", "path TEXT", "version TEXT", "timestamp TEXT"),
+		versions: db.CreateTable("module_versions", "id INTEGER PRIMARY KEY", "index_record_id INTEGER", "go TEXT"),
+		requires: db.CreateTable("requires", "module_version_id INTEGER", "path TEXT", "version TEXT", "indirect INTEGER"),
+		replaces: db.CreateTable("replaces", "module_version_id INTEGER", "old_path TEXT", "old_version TEXT", "new_path TEXT", "new_version TEXT"),
+		excludes: db.CreateTable("excludes", "module_version_id INTEGER", "path TEXT", "version TEXT"),
+		tokens:   db.CreateTable("tokens", "module_version_id INTEGER", "token TEXT", "count INTEGER"),
+		idents:   db.CreateTable("idents", "module_version_id INTEGER", "ident TEXT", "count INTEGER"),
+	}
+	for _, idx := range []struct {
+		t    *sqlite.Table
+		name string
+		cols []string
+	}{
+		{a.records, "index_records_path", []string{"path", "version"}},
+		{a.records, "index_records_timestamp", []string{"timestamp"}},
+		{a.versions, "module_versions_index_record", []string{"index_record_id"}},
+		{a.versions, "module_versions_go", []string{"go"}},
+		{a.requires, "requires_module_version", []string{"module_version_id"}},
+		{a.requires, "requires_path", []string{"path", "version"}},
+		{a.replaces, "replaces_module_version", []string{"module_version_id"}},
+		{a.replaces, "replaces_old_path", []string{"old_path"}},
+		{a.replaces, "replaces_new_path", []string{"new_path"}},
+		{a.excludes, "excludes_module_version", []string{"module_version_id"}},
+		{a.excludes, "excludes_path", []string{"path", "version"}},
+		{a.tokens, "tokens_module_version", []string{"module_version_id"}},
+		{a.tokens, "tokens_token", []string{"token"}},
+		{a.idents, "idents_module_version", []string{"module_version_id"}},
+		{a.idents, "idents_ident", []string{"ident"}},
+	} {
+		err = idx.t.CreateIndex(idx.name, idx.cols...)
+		if err != nil {
+			return nil, fmt.Errorf("newSqliteAggregator: %w", err)
+		}
+	}
+	return a, nil
+}
+
+func (a *sqliteAggregator) Name() string { return "sqlite" }
+
+func (a *sqliteAggregator) Record(ir *pb.IndexRecord) error {
+	id, err := a.records.Insert(nil, ir.Path, ir.Version, ir.Timestamp)
+	if err != nil {
+		return err
+	}
+	a.ids[ir.Path+"@"+ir.Version] = id
+	return nil
+}
+
+func (a *sqliteAggregator) Selected(ir *pb.IndexRecord, mv *pb.ModuleVersion) error {
+	id, err := a.versions.Insert(nil, a.ids[ir.Path+"@"+ir.Version], mv.Go)
+	if err != nil {
+		return err
+	}
+	for _, r := range mv.Requires {
+		_, err = a.requires.Insert(id, r.Version.Module, r.Version.Version, r.Indirect)
+		if err != nil {
+			return err
+		}
+	}
+	for _, r := range mv.Replaces {
+		_, err = a.replaces.Insert(id, r.Old.Module, r.Old.Version, r.New.Module, r.New.Version)
+		if err != nil {
+			return err
+		}
+	}
+	for _, e := range mv.Excludes {
+		_, err = a.excludes.Insert(id, e.Module, e.Version)
+		if err != nil {
+			return err
+		}
+	}
+	err = insertCounts(a.tokens, id, mv.Tokens)
+	if err != nil {
+		return err
+	}
+	return insertCounts(a.idents, id, mv.Idents)
+}
+
+func (a *sqliteAggregator) Write() error {
+	return a.db.Close()
+}
+
+// insertCounts inserts a row per key in key order
+func insertCounts(t *sqlite.Table, id int64, m map[string]int64) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		_, err := t.Insert(id, k, m[k])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parquetAggregator streams the selected module versions into a directory of parquet files,
+// one per table with the nested lists and maps flattened into rows keyed by path and version:
+//
+//	module_versions(path, version, timestamp, go, requires, replaces, excludes, tokens, idents)
+//	requires(path, version, require_path, require_version, indirect)
+//	replaces(path, version, old_path, old_version, new_path, new_version)
+//	excludes(path, version, exclude_path, exclude_version)
+//	tokens(path, version, token, count)
+//	idents(path, version, ident, count)
+type parquetAggregator struct {
+	versions *parquet.Writer
+	requires *parquet.Writer
+	replaces *parquet.Writer
+	excludes *parquet.Writer
+	tokens   *parquet.Writer
+	idents   *parquet.Writer
+}
+
+func newParquetAggregator(dir string) (*parquetAggregator, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("newParquetAggregator: %w", err)
+	}
+	str := func(names ...string) []parquet.Column {
+		cs := make([]parquet.Column, 0, len(names))
+		for _, n := range names {
+			cs = append(cs, parquet.Column{Name: n, Type: parquet.String})
+		}
+		return cs
+	}
+	count := func(name string) parquet.Column {
+		return parquet.Column{Name: name, Type: parquet.Int64}
+	}
+
+	var a parquetAggregator
+	for _, t := range []struct {
+		w    **parquet.Writer
+		name string
+		cols []parquet.Column
+	}{
+		{&a.versions, "module_versions", append(str("path", "version", "timestamp", "go"),
+			count("requires"), count("replaces"), count("excludes"), count("tokens"), count("idents"))},
+		{&a.requires, "requires", append(str("path", "version", "require_path", "require_version"),
+			parquet.Column{Name: "indirect", Type: parquet.Bool})},
+		{&a.replaces, "replaces", str("path", "version", "old_path", "old_version", "new_path", "new_version")},
+		{&a.excludes, "excludes", str("path", "version", "exclude_path", "exclude_version")},
+		{&a.tokens, "tokens", append(str("path", "version", "token"), count("count"))},
+		{&a.idents, "idents", append(str("path", "version", "ident"), count("count"))},
+	} {
+		*t.w, err = parquet.Create(filepath.Join(dir, t.name+".parquet"), t.cols...)
+		if err != nil {
+			return nil, fmt.Errorf("newParquetAggregator: %w", err)
+		}
+	}
+	return &a, nil
+}
+
+func (a *parquetAggregator) Name() string { return "parquet" }
+
+func (a *parquetAggregator) Selected(ir *pb.IndexRecord, mv *pb.ModuleVersion) error {
+	var tokens, idents int64
+	for _, c := range mv.Tokens {
+		tokens += c
+	}
+	for _, c := range mv.Idents {
+		idents += c
+	}
+	err := a.versions.Write(ir.Path, ir.Version, ir.Timestamp, mv.Go,
+		len(mv.Requires), len(mv.Replaces), len(mv.Excludes), tokens, idents)
+	if err != nil {
+		return err
+	}
+	for _, r := range mv.Requires {
+		err = a.requires.Write(ir.Path, ir.Version, r.Version.Module, r.Version.Version, r.Indirect)
+		if err != nil {
+			return err
+		}
+	}
+	for _, r := range mv.Replaces {
+		err = a.replaces.Write(ir.Path, ir.Version, r.Old.Module, r.Old.Version, r.New.Module, r.New.Version)
+		if err != nil {
+			return err
+		}
+	}
+	for _, e := range mv.Excludes {
+		err = a.excludes.Write(ir.Path, ir.Version, e.Module, e.Version)
+		if err != nil {
+			return err
+		}
+	}
+	err = writeCounts(a.tokens, ir, mv.Tokens)
+	if err != nil {
+		return err
+	}
+	return writeCounts(a.idents, ir, mv.Idents)
+}
+
+func (a *parquetAggregator) Write() error {
+	for _, w := range []*parquet.Writer{a.versions, a.requires, a.replaces, a.excludes, a.tokens, a.idents} {
+		err := w.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCounts writes a row per key in key order
+func writeCounts(w *parquet.Writer, ir *pb.IndexRecord, m map[string]int64) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		err := w.Write(ir.Path, ir.Version, k, m[k])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
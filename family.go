@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.seankhliao.com/gomodstats/v2/pb"
+	"golang.org/x/mod/module"
+)
+
+// family returns the module path without its major version suffix
+// and the major version it names, v0/v1 for unsuffixed paths
+func family(path string) (prefix, major string) {
+	prefix, pathMajor, ok := module.SplitPathVersion(path)
+	if !ok {
+		return path, "v0/v1"
+	}
+	major = strings.TrimLeft(pathMajor, "./")
+	if major == "" {
+		major = "v0/v1"
+	}
+	return prefix, major
+}
+
+// majorsAggregator reports how many major versions each module family publishes
+// and how the dependents (by selected version requires) split across them
+type majorsAggregator struct {
+	fams     map[string][]string
+	versions map[string]int
+	deps     dependents
+}
+
+func newMajorsAggregator() *majorsAggregator {
+	return &majorsAggregator{
+		fams:     make(map[string][]string),
+		versions: make(map[string]int),
+		deps:     newDependents(),
+	}
+}
+
+func (a *majorsAggregator) Name() string { return "majors" }
+
+func (a *majorsAggregator) Module(m string, irs []*pb.IndexRecord) error {
+	f, _ := family(m)
+	a.fams[f] = append(a.fams[f], m)
+	a.versions[m] = len(irs)
+	return nil
+}
+
+func (a *majorsAggregator) Selected(ir *pb.IndexRecord, mv *pb.ModuleVersion) error {
+	a.deps.add(ir, mv)
+	return nil
+}
+
+func (a *majorsAggregator) Write() error {
+	dist := make(map[string]int64)
+	var rows [][]string
+	for f, ms := range a.fams {
+		dist[strconv.Itoa(len(ms))]++
+		if len(ms) < 2 {
+			continue
+		}
+		for _, m := range ms {
+			_, major := family(m)
+			rows = append(rows, []string{f, major, m, strconv.Itoa(a.versions[m]), strconv.FormatInt(a.deps.count[m], 10)})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i][0] != rows[j][0] {
+			return rows[i][0] < rows[j][0]
+		}
+		return rows[i][2] < rows[j][2]
+	})
+
+	log.Printf("majors modules=%d families=%d", len(a.versions), len(a.fams))
+	err := writeMap("families-majors", dist)
+	if err != nil {
+		return err
+	}
+	return writeTable("families-dependents", []string{"family", "major", "module", "versions:int", "dependents:int"}, rows)
+}
@@ -3,18 +3,17 @@ package main
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"go/scanner"
-	"go/token"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"go.seankhliao.com/gomodstats/v2/pb"
@@ -23,15 +22,65 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
-func Modules(pbi *pb.Index) {
-	var modt, modv, done, gone, errc int64
+// Modules fetches and analyzes every module version in the index
+// that has no stored results and isn't known to be gone.
+// Once ctx is canceled no new versions are started,
+// in-flight ones get drainTimeout to finish before they are aborted
+func Modules(ctx context.Context, pbi *pb.Index) {
+	work, abort := context.WithCancel(context.Background())
+	defer abort()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-work.Done():
+			return
+		}
+		t := time.NewTimer(drainTimeout)
+		defer t.Stop()
+		select {
+		case <-t.C:
+			log.Println("Modules: drain timed out, aborting in-flight work")
+			abort()
+		case <-work.Done():
+		}
+	}()
 
 	mods := make(map[string][]string)
 	for _, ir := range pbi.Records {
 		mods[ir.Path] = append(mods[ir.Path], ir.Version)
-		modv++
 	}
-	modt = int64(len(mods))
+	crawlModules.set("", float64(len(mods)))
+	crawlVersions.set("", float64(len(pbi.Records)))
+
+	// saving an empty list would drop the existing records
+	pbg, err := loadGone()
+	if err != nil {
+		log.Println("Modules", err)
+		return
+	}
+	gone := make(map[string]bool, len(pbg.Records))
+	for _, gr := range pbg.Records {
+		gone[gr.Path+"@"+gr.Version] = true
+	}
+
+	// saveChkpt writes new gone records, it runs on every tick
+	// as a second signal exits without running deferred functions
+	var gonemu sync.Mutex
+	saved := len(pbg.Records)
+	saveChkpt := func() {
+		gonemu.Lock()
+		defer gonemu.Unlock()
+		if len(pbg.Records) == saved {
+			return
+		}
+		err := saveGone(pbg)
+		if err != nil {
+			log.Println("Modules", err)
+			return
+		}
+		saved = len(pbg.Records)
+	}
+	defer saveChkpt()
 
 	var wg sync.WaitGroup
 	sem := make(chan struct{}, limit)
@@ -39,43 +88,123 @@ func Modules(pbi *pb.Index) {
 		sem <- struct{}{}
 	}
 
-	defer fmt.Printf("progress done=%v gone=%v err=%v mods=%v modv=%v\n", atomic.LoadInt64(&done), atomic.LoadInt64(&gone), atomic.LoadInt64(&errc), modt, modv)
+	defer printProgress()
+	tick := *progress
+	if tick <= 0 {
+		tick = chkptInterval
+	}
+	t := time.NewTicker(tick)
+	defer t.Stop()
+	done := make(chan struct{})
+	defer close(done)
 	go func() {
-		for range time.NewTicker(15 * time.Second).C {
-			fmt.Printf("progress done=%v gone=%v err=%v mods=%v modv=%v\n", atomic.LoadInt64(&done), atomic.LoadInt64(&gone), atomic.LoadInt64(&errc), modt, modv)
+		for {
+			select {
+			case <-t.C:
+				if *progress > 0 {
+					printProgress()
+				}
+				saveChkpt()
+			case <-done:
+				return
+			}
 		}
 	}()
 
+	var started, skipped int
+loop:
 	for m, vers := range mods {
 		sort.Slice(vers, func(i, j int) bool {
 			return semver.Compare(vers[i], vers[j]) == -1
 		})
 
 		for _, v := range vers {
+			if gone[m+"@"+v] {
+				skipped++
+				continue
+			} else if _, err := os.Stat(modFile(".", m, v)); err == nil {
+				skipped++
+				continue
+			}
+			// select picks at random when a slot and cancellation are both ready,
+			// so check ctx on both sides of taking a slot
+			if ctx.Err() != nil {
+				break loop
+			}
+			select {
+			case <-sem:
+			case <-ctx.Done():
+				break loop
+			}
+			if ctx.Err() != nil {
+				sem <- struct{}{}
+				break loop
+			}
+			started++
 			wg.Add(1)
-			<-sem
 			go func(m, v string) {
+				crawlInflight.add("", 1)
 				defer func() {
+					crawlInflight.add("", -1)
 					wg.Done()
 					sem <- struct{}{}
 				}()
-				err := getMod(m, v)
-				if err != nil && strings.Contains(err.Error(), "410 Gone") {
-					atomic.AddInt64(&gone, 1)
+				err := getMod(work, m, v)
+				if err != nil && work.Err() != nil {
+					log.Printf("mod aborted %s %s", m, v)
+				} else if err != nil && strings.Contains(err.Error(), "410 Gone") {
+					crawlGone.add("", 1)
+					gonemu.Lock()
+					pbg.Records = append(pbg.Records, &pb.GoneRecord{
+						Path:     m,
+						Version:  v,
+						Observed: time.Now().UTC().Format(time.RFC3339),
+					})
+					gonemu.Unlock()
 				} else if err != nil {
 					log.Printf("mod %v", err)
-					atomic.AddInt64(&errc, 1)
+					crawlErrors.add(errorCategory(err), 1)
 					return
 				} else {
-					atomic.AddInt64(&done, 1)
+					crawlDone.add("", 1)
 				}
 			}(m, v)
 		}
 	}
 	wg.Wait()
+	log.Printf("Modules: skipped %d module versions already stored or gone", skipped)
+	if ctx.Err() != nil {
+		log.Printf("Modules: stopped with %d module versions not started", len(pbi.Records)-started-skipped)
+	}
+}
+
+// printProgress is the human view of the crawl metrics
+func printProgress() {
+	fmt.Printf("progress done=%v gone=%v err=%v mods=%v modv=%v\n",
+		crawlDone.value(""), crawlGone.value(""), crawlErrors.total(), crawlModules.value(""), crawlVersions.value(""))
+}
+
+// fetch reads a file of kind mod or zip from the proxy into buf,
+// recording its size and request time.
+// The status code is 0 if the request failed
+func fetch(ctx context.Context, buf *bytes.Buffer, m, v, kind string) (int, error) {
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/%s/@v/%s.%s", proxyURL, m, v, kind), nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	n, err := buf.ReadFrom(res.Body)
+	crawlBytes.add(kind, float64(n))
+	crawlLatency.observe(kind, time.Since(start).Seconds())
+	return res.StatusCode, err
 }
 
-func getMod(m, v string) error {
+func getMod(ctx context.Context, m, v string) error {
 	bufi := pool.Get()
 	buf, ok := bufi.(*bytes.Buffer)
 	if !ok {
@@ -86,20 +215,17 @@ func getMod(m, v string) error {
 		pool.Put(buf)
 	}()
 
-	res, err := http.Get(fmt.Sprintf("%s/%s/@v/%s.mod", proxyURL, m, v))
-	if err != nil {
-		return fmt.Errorf("modfile get %s %s: %w", m, v, err)
-	} else if res.StatusCode != 200 {
-		return fmt.Errorf("modfile get %s %s: %d %s", m, v, res.StatusCode, res.Status)
-	}
-	defer res.Body.Close()
-	_, err = buf.ReadFrom(res.Body)
-	if err != nil {
-		return fmt.Errorf("modfile read %s %s: %w", m, v, err)
+	code, err := fetch(ctx, buf, m, v, "mod")
+	if code == 0 {
+		return crawlErrorf("modfile_get", "modfile get %s %s: %w", m, v, err)
+	} else if code != 200 {
+		return crawlErrorf("modfile_status", "modfile status %s %s: %d %s", m, v, code, http.StatusText(code))
+	} else if err != nil {
+		return crawlErrorf("modfile_read", "modfile read %s %s: %w", m, v, err)
 	}
 	mf, err := modfile.Parse(fmt.Sprintf("%s@%s", m, v), buf.Bytes(), nil)
 	if err != nil {
-		return fmt.Errorf("modfile parse %s %s: %w", m, v, err)
+		return crawlErrorf("modfile_parse", "modfile parse %s %s: %w", m, v, err)
 	}
 	pbm := pb.ModuleVersion{
 		Version: v,
@@ -136,78 +262,77 @@ func getMod(m, v string) error {
 	}
 
 	buf.Reset()
-	res, err = http.Get(fmt.Sprintf("%s/%s/@v/%s.zip", proxyURL, m, v))
-	if err != nil {
-		return fmt.Errorf("module get %s %s: %w", m, v, err)
-	} else if res.StatusCode != 200 {
-		return fmt.Errorf("module status %s %s: %d %s", m, v, res.StatusCode, res.Status)
-	}
-	defer res.Body.Close()
-	_, err = buf.ReadFrom(res.Body)
-	if err != nil {
-		return fmt.Errorf("module read %s %s: %w", m, v, err)
+	code, err = fetch(ctx, buf, m, v, "zip")
+	if code == 0 {
+		return crawlErrorf("module_get", "module get %s %s: %w", m, v, err)
+	} else if code != 200 {
+		return crawlErrorf("module_status", "module status %s %s: %d %s", m, v, code, http.StatusText(code))
+	} else if err != nil {
+		return crawlErrorf("module_read", "module read %s %s: %w", m, v, err)
 	}
 	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
 	if err != nil {
-		return fmt.Errorf("module unzip %s %s: %w", m, v, err)
+		return crawlErrorf("module_unzip", "module unzip %s %s: %w", m, v, err)
 	}
-	fset := token.NewFileSet()
-
-	pbm.Tokens = make(map[string]int64, 90)
-	pbm.Idents = make(map[string]int64, 1000)
-
-	bufi = pool.Get()
-	buf2, ok := bufi.(*bytes.Buffer)
-	if !ok {
-		return fmt.Errorf("buffer assert failed, type=%T", bufi)
+	files := Files{
+		prefix: m + "@" + v + "/",
+		r:      r,
 	}
-	defer func() {
-		buf2.Reset()
-		pool.Put(buf2)
-	}()
-
-	for _, zf := range r.File {
-		if filepath.Ext(zf.Name) != ".go" {
-			continue
-		}
-		rc, err := zf.Open()
+	for _, a := range analyzers {
+		err = a.Analyze(m, v, mf, files, &pbm)
 		if err != nil {
-			return fmt.Errorf("module open %s %s %s: %w", m, v, zf.Name, err)
-		}
-		buf2.Reset()
-		_, err = buf2.ReadFrom(rc)
-		rc.Close()
-		if err != nil {
-			return fmt.Errorf("module read %s %s %s: %w", m, v, zf.Name, err)
-		}
-		file := fset.AddFile(zf.Name, fset.Base(), buf2.Len())
-		var s scanner.Scanner
-		s.Init(file, buf2.Bytes(), nil, scanner.ScanComments)
-		for {
-			_, tok, lit := s.Scan()
-			if tok == token.EOF {
-				break
-			} else if tok == token.IDENT {
-				pbm.Idents[lit]++
-			}
-			pbm.Tokens[tok.String()]++
+			return crawlErrorf("module_analyze", "module analyze %s %s %s: %w", m, v, a.Name(), err)
 		}
 	}
 
 	b, err := proto.Marshal(&pbm)
 	if err != nil {
-		return fmt.Errorf("module marshal %s %s: %w", m, v, err)
+		return crawlErrorf("module_marshal", "module marshal %s %s: %w", m, v, err)
+	}
+	f := modFile(".", m, v)
+	err = writeFileAtomic(f, b)
+	if err != nil {
+		return crawlErrorf("mod_write", "mod write %s: %w", f, err)
+	}
+	return nil
+}
+
+func loadGone() (*pb.Gone, error) {
+	return readGone(".")
+}
+
+// readGone reads the gone checkpoint from a dataset directory,
+// a missing checkpoint has no records
+func readGone(dir string) (*pb.Gone, error) {
+	var pbg pb.Gone
+	b, err := ioutil.ReadFile(filepath.Join(dir, chkptGone))
+	if os.IsNotExist(err) {
+		return &pbg, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("readGone read %s: %w", dir, err)
 	}
-	f := fmt.Sprintf("%s/%s@%s.pb", "mods", strings.ReplaceAll(m, "/", "--"), v)
-	err = ioutil.WriteFile(f, b, 0o644)
+	err = proto.Unmarshal(b, &pbg)
 	if err != nil {
+		return nil, fmt.Errorf("readGone unmarshal %s: %w", dir, err)
+	}
+	return &pbg, nil
+}
 
-		return fmt.Errorf("mod write %s: %w", f, err)
+func saveGone(pbg *pb.Gone) error {
+	b, err := proto.Marshal(pbg)
+	if err != nil {
+		return fmt.Errorf("saveGone marshal: %w", err)
+	}
+	err = writeFileAtomic(chkptGone, b)
+	if err != nil {
+		return fmt.Errorf("saveGone write: %w", err)
 	}
 	return nil
 }
 
-func Index() (*pb.Index, error) {
+// Index reads the index checkpoint,
+// or downloads the full index and checkpoints it
+func Index(ctx context.Context) (*pb.Index, error) {
 	var pbi pb.Index
 	b, err := ioutil.ReadFile(chkptIndex)
 	if err == nil {
@@ -226,10 +351,15 @@ func Index() (*pb.Index, error) {
 		if ts != "" {
 			u += "?since=" + ts
 		}
-		res, err := http.Get(u)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Index request: %w", err)
+		}
+		res, err := http.DefaultClient.Do(req)
 		if err != nil {
 			return nil, fmt.Errorf("Index get: %w", err)
 		} else if res.StatusCode != 200 {
+			res.Body.Close()
 			return nil, fmt.Errorf("Index status: %d %s", res.StatusCode, res.Status)
 		}
 		prev = 0
@@ -238,21 +368,49 @@ func Index() (*pb.Index, error) {
 			var ir pb.IndexRecord
 			err = d.Decode(&ir)
 			if err != nil {
+				res.Body.Close()
 				return nil, fmt.Errorf("Index decode: %w", err)
 			}
 			pbi.Records = append(pbi.Records, &ir)
 			prev++
 			ts = ir.Timestamp
 		}
+		res.Body.Close()
 	}
 
 	b, err = proto.Marshal(&pbi)
 	if err != nil {
 		return nil, fmt.Errorf("Index marshal: %w", err)
 	}
-	err = ioutil.WriteFile(chkptIndex, b, 0644)
+	err = writeFileAtomic(chkptIndex, b)
 	if err != nil {
 		return nil, fmt.Errorf("Index write: %w", err)
 	}
 	return &pbi, nil
 }
+
+// writeFileAtomic writes b to a temporary file next to fn and renames it into place,
+// so an interrupted write never leaves a partial fn
+func writeFileAtomic(fn string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(fn), filepath.Base(fn)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("writeFileAtomic create: %w", err)
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), fn)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("writeFileAtomic %s: %w", fn, err)
+	}
+	return nil
+}
@@ -1,9 +1,9 @@
 module go.seankhliao.com/gomodstats/v2
 
-go 1.14
+go 1.17
 
 require (
 	github.com/golang/protobuf v1.4.1
-	golang.org/x/mod v0.2.0
+	golang.org/x/mod v0.10.0
 	google.golang.org/protobuf v1.22.0
 )
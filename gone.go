@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.seankhliao.com/gomodstats/v2/pb"
+)
+
+// goneAggregator reports module versions the proxy answered 410 Gone for
+// that the selected versions of other modules still require
+type goneAggregator struct {
+	pbg      *pb.Gone
+	gone     map[string]bool
+	required map[string][]string
+}
+
+func newGoneAggregator() (*goneAggregator, error) {
+	pbg, err := loadGone()
+	if err != nil {
+		return nil, fmt.Errorf("newGoneAggregator: %w", err)
+	}
+	a := &goneAggregator{
+		pbg:      pbg,
+		gone:     make(map[string]bool, len(pbg.Records)),
+		required: make(map[string][]string),
+	}
+	for _, gr := range pbg.Records {
+		a.gone[gr.Path+"@"+gr.Version] = true
+	}
+	return a, nil
+}
+
+func (a *goneAggregator) Name() string { return "gone" }
+
+func (a *goneAggregator) Selected(ir *pb.IndexRecord, mv *pb.ModuleVersion) error {
+	for _, r := range mv.Requires {
+		mod := r.Version.Module + "@" + r.Version.Version
+		if !a.gone[mod] {
+			continue
+		}
+		// versions of a module are selected together
+		if n := len(a.required[mod]); n == 0 || a.required[mod][n-1] != ir.Path {
+			a.required[mod] = append(a.required[mod], ir.Path)
+		}
+	}
+	return nil
+}
+
+func (a *goneAggregator) Write() error {
+	seen := make(map[string]bool)
+	goneMods := make(map[string]int64)
+	var rows [][]string
+	for _, gr := range a.pbg.Records {
+		mod := gr.Path + "@" + gr.Version
+		if seen[mod] {
+			continue
+		}
+		seen[mod] = true
+		goneMods[gr.Path]++
+
+		deps := a.required[mod]
+		if len(deps) == 0 {
+			continue
+		}
+		sort.Strings(deps)
+		rows = append(rows, []string{gr.Path, gr.Version, gr.Observed, strconv.Itoa(len(deps)), strings.Join(deps, " ")})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i][0] != rows[j][0] {
+			return rows[i][0] < rows[j][0]
+		}
+		return rows[i][1] < rows[j][1]
+	})
+
+	log.Printf("gone versions=%d modules=%d required=%d", len(seen), len(goneMods), len(rows))
+	err := writeMap("gone-modules", goneMods)
+	if err != nil {
+		return err
+	}
+	return writeTable("gone-required", []string{"module", "version", "observed", "dependents:int", "paths"}, rows)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.seankhliao.com/gomodstats/v2/pb"
+)
+
+// histogram collects values of a metric to bin and summarize
+type histogram struct {
+	values []float64
+	sorted bool
+}
+
+func (h *histogram) add(v float64) {
+	h.values = append(h.values, v)
+	h.sorted = false
+}
+
+func (h *histogram) sort() {
+	if !h.sorted {
+		sort.Float64s(h.values)
+		h.sorted = true
+	}
+}
+
+// quantile interpolates between the closest ranks, q in [0, 1]
+func (h *histogram) quantile(q float64) float64 {
+	h.sort()
+	if len(h.values) == 0 {
+		return 0
+	}
+	pos := q * float64(len(h.values)-1)
+	i := int(pos)
+	if i+1 >= len(h.values) {
+		return h.values[len(h.values)-1]
+	}
+	return h.values[i] + (pos-float64(i))*(h.values[i+1]-h.values[i])
+}
+
+// edges returns the n+1 bin edges for a binning kind:
+// linear (equal width), log (equal width in log(1+v)) or quantile (equal counts).
+// Quantile edges can collapse on repeated values, leaving fewer bins
+func (h *histogram) edges(kind string, n int) ([]float64, error) {
+	switch kind {
+	case "linear", "log", "quantile":
+	default:
+		return nil, fmt.Errorf("edges: unknown binning %q", kind)
+	}
+	h.sort()
+	if len(h.values) == 0 {
+		return nil, nil
+	}
+	min, max := h.values[0], h.values[len(h.values)-1]
+	var e []float64
+	switch kind {
+	case "linear":
+		for i := 0; i <= n; i++ {
+			e = append(e, min+(max-min)*float64(i)/float64(n))
+		}
+	case "log":
+		if min < 0 {
+			return nil, fmt.Errorf("edges: log bins need values >= 0, have %v", min)
+		}
+		lmin, lmax := math.Log1p(min), math.Log1p(max)
+		for i := 0; i <= n; i++ {
+			e = append(e, math.Expm1(lmin+(lmax-lmin)*float64(i)/float64(n)))
+		}
+		// exact ends despite rounding
+		e[0], e[n] = min, max
+	case "quantile":
+		for i := 0; i <= n; i++ {
+			q := h.quantile(float64(i) / float64(n))
+			if len(e) == 0 || q > e[len(e)-1] {
+				e = append(e, q)
+			}
+		}
+		if len(e) == 1 {
+			e = append(e, e[0])
+		}
+	}
+	return e, nil
+}
+
+// bins counts values in [edges[i], edges[i+1]), the last bin includes its upper edge
+func (h *histogram) bins(edges []float64) []int64 {
+	if len(edges) < 2 {
+		return nil
+	}
+	counts := make([]int64, len(edges)-1)
+	for _, v := range h.values {
+		i := sort.Search(len(edges), func(i int) bool { return edges[i] > v }) - 1
+		if i < 0 {
+			i = 0
+		} else if i >= len(counts) {
+			i = len(counts) - 1
+		}
+		counts[i]++
+	}
+	return counts
+}
+
+// summary returns count, min, max, mean, median, p90 and p99 rows
+func (h *histogram) summary() [][]string {
+	h.sort()
+	var sum float64
+	for _, v := range h.values {
+		sum += v
+	}
+	var min, max, mean float64
+	if n := len(h.values); n > 0 {
+		min, max, mean = h.values[0], h.values[n-1], sum/float64(n)
+	}
+	return [][]string{
+		{"count", strconv.Itoa(len(h.values))},
+		{"min", formatFloat(min)},
+		{"max", formatFloat(max)},
+		{"mean", formatFloat(mean)},
+		{"median", formatFloat(h.quantile(0.5))},
+		{"p90", formatFloat(h.quantile(0.9))},
+		{"p99", formatFloat(h.quantile(0.99))},
+	}
+}
+
+// formatFloat rounds to 2 decimal places
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
+
+// histogramAggregator bins numeric query expressions (see queryAggregator)
+// over the selected module versions,
+// writing histogram-{metric}.csv and histogram-{metric}-summary.csv for each
+type histogramAggregator struct {
+	metrics []ast.Expr
+	names   []string
+	hists   []*histogram
+	kind    string
+	n       int
+}
+
+func newHistogramAggregator(metrics, kind string, n int) (*histogramAggregator, error) {
+	ms, names, err := parseQueryList(metrics)
+	if err != nil {
+		return nil, fmt.Errorf("newHistogramAggregator: %w", err)
+	}
+	if len(ms) == 0 {
+		return nil, fmt.Errorf("newHistogramAggregator: no metrics given")
+	}
+	if n < 1 {
+		return nil, fmt.Errorf("newHistogramAggregator: need at least 1 bin, got %d", n)
+	}
+	a := &histogramAggregator{
+		metrics: ms,
+		names:   names,
+		kind:    kind,
+		n:       n,
+	}
+	for range ms {
+		a.hists = append(a.hists, &histogram{})
+	}
+	_, err = a.hists[0].edges(kind, n)
+	if err != nil {
+		return nil, fmt.Errorf("newHistogramAggregator: %w", err)
+	}
+	return a, nil
+}
+
+func (a *histogramAggregator) Name() string { return "histogram" }
+
+func (a *histogramAggregator) Selected(ir *pb.IndexRecord, mv *pb.ModuleVersion) error {
+	env := queryEnv{ir, mv}
+	for i, m := range a.metrics {
+		v, err := env.eval(m)
+		if err != nil {
+			log.Println("histogram", ir.Path, ir.Version, err)
+			continue
+		}
+		n, ok := v.(int64)
+		if !ok {
+			log.Println("histogram", ir.Path, ir.Version, a.names[i], "is not a number:", v)
+			continue
+		}
+		a.hists[i].add(float64(n))
+	}
+	return nil
+}
+
+func (a *histogramAggregator) Write() error {
+	for i, h := range a.hists {
+		name := "histogram-" + metricName(a.names[i])
+		edges, err := h.edges(a.kind, a.n)
+		if err != nil {
+			return err
+		}
+		var rows [][]string
+		for j, c := range h.bins(edges) {
+			rows = append(rows, []string{formatFloat(edges[j]), formatFloat(edges[j+1]), strconv.FormatInt(c, 10)})
+		}
+		err = writeTable(name, []string{"lower:float", "upper:float", "count:int"}, rows)
+		if err != nil {
+			return err
+		}
+		err = writeTable(name+"-summary", []string{"stat", "value:float"}, h.summary())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metricName makes a metric expression usable in a file name
+func metricName(expr string) string {
+	return strings.Trim(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, expr), "_")
+}
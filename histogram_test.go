@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestQuantile(t *testing.T) {
+	h := &histogram{values: []float64{4, 1, 3, 2}}
+	for _, tt := range []struct {
+		q, want float64
+	}{
+		{0, 1},
+		{0.5, 2.5},
+		{1, 4},
+		{1 / 3.0, 2},
+	} {
+		if got := h.quantile(tt.q); got != tt.want {
+			t.Errorf("quantile(%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+	if got := (&histogram{}).quantile(0.5); got != 0 {
+		t.Errorf("quantile of no values = %v, want 0", got)
+	}
+}
+
+func TestEdges(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		kind   string
+		n      int
+		want   []float64
+		err    bool
+	}{
+		{"linear", []float64{0, 1, 10}, "linear", 2, []float64{0, 5, 10}, false},
+		{"log", []float64{0, 3, 99}, "log", 2, []float64{0, 9, 99}, false},
+		{"log negative", []float64{-1, 3}, "log", 2, nil, true},
+		{"quantile", []float64{1, 2, 3, 4, 5}, "quantile", 4, []float64{1, 2, 3, 4, 5}, false},
+		// repeated values collapse into fewer bins
+		{"quantile collapsed", []float64{1, 1, 1, 1, 5}, "quantile", 4, []float64{1, 5}, false},
+		{"quantile one value", []float64{7, 7, 7}, "quantile", 4, []float64{7, 7}, false},
+		{"empty", nil, "linear", 4, nil, false},
+		{"unknown", []float64{1}, "cubic", 4, nil, true},
+	}
+	for _, tt := range tests {
+		h := &histogram{values: tt.values}
+		got, err := h.edges(tt.kind, tt.n)
+		if (err != nil) != tt.err || !floatsNear(got, tt.want) {
+			t.Errorf("%s: edges = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// floatsNear reports whether a and b are equal up to rounding
+func floatsNear(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBins(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		edges  []float64
+		want   []int64
+	}{
+		{"half open", []float64{0, 1, 2, 3, 4}, []float64{0, 2, 4}, []int64{2, 3}},
+		// the maximum is counted in the last bin
+		{"last bin clamped", []float64{4, 4}, []float64{0, 2, 4}, []int64{0, 2}},
+		{"collapsed edges", []float64{7, 7}, []float64{7, 7}, []int64{2}},
+		{"below first edge", []float64{-1}, []float64{0, 1}, []int64{1}},
+		{"no bins", []float64{1}, []float64{1}, nil},
+	}
+	for _, tt := range tests {
+		h := &histogram{values: tt.values}
+		if got := h.bins(tt.edges); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: bins(%v) = %v, want %v", tt.name, tt.edges, got, tt.want)
+		}
+	}
+}
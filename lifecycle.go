@@ -0,0 +1,136 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.seankhliao.com/gomodstats/v2/pb"
+)
+
+// lifecycleAggregator reports per module publish history:
+// first and last publish, active span, mean days between releases
+// and days since the last release, measured from the newest index record.
+// Modules with nothing published within the abandoned threshold
+// that other modules still require are listed separately
+type lifecycleAggregator struct {
+	abandoned time.Duration
+	now       time.Time
+	mods      []moduleLifecycle
+	deps      dependents
+}
+
+type moduleLifecycle struct {
+	module             string
+	versions, releases int
+	first, last        time.Time
+	firstRel, lastRel  time.Time
+}
+
+func newLifecycleAggregator(abandoned time.Duration) *lifecycleAggregator {
+	return &lifecycleAggregator{
+		abandoned: abandoned,
+		deps:      newDependents(),
+	}
+}
+
+func (a *lifecycleAggregator) Name() string { return "lifecycle" }
+
+func (a *lifecycleAggregator) Record(ir *pb.IndexRecord) error {
+	t, err := time.Parse(time.RFC3339Nano, ir.Timestamp)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	if t.After(a.now) {
+		a.now = t
+	}
+	return nil
+}
+
+func (a *lifecycleAggregator) Module(m string, irs []*pb.IndexRecord) error {
+	ml := moduleLifecycle{
+		module:   m,
+		versions: len(irs),
+	}
+	for _, ir := range irs {
+		t, err := time.Parse(time.RFC3339Nano, ir.Timestamp)
+		if err != nil {
+			continue
+		}
+		if ml.first.IsZero() || t.Before(ml.first) {
+			ml.first = t
+		}
+		if t.After(ml.last) {
+			ml.last = t
+		}
+		if versionKind(ir.Version) != "release" {
+			continue
+		}
+		ml.releases++
+		if ml.firstRel.IsZero() || t.Before(ml.firstRel) {
+			ml.firstRel = t
+		}
+		if t.After(ml.lastRel) {
+			ml.lastRel = t
+		}
+	}
+	if ml.first.IsZero() {
+		return nil
+	}
+	a.mods = append(a.mods, ml)
+	return nil
+}
+
+func (a *lifecycleAggregator) Selected(ir *pb.IndexRecord, mv *pb.ModuleVersion) error {
+	a.deps.add(ir, mv)
+	return nil
+}
+
+func (a *lifecycleAggregator) Write() error {
+	header := []string{"module", "versions:int", "releases:int", "first", "last", "spandays:float", "cadencedays:float", "sincereleasedays:float", "dependents:int"}
+	rows := make([][]string, 0, len(a.mods))
+	var abandonedRows [][]string
+	for _, ml := range a.mods {
+		var cadence, since string
+		if ml.releases > 1 {
+			cadence = days(ml.lastRel.Sub(ml.firstRel) / time.Duration(ml.releases-1))
+		}
+		if ml.releases > 0 {
+			since = days(a.now.Sub(ml.lastRel))
+		}
+		row := []string{
+			ml.module,
+			strconv.Itoa(ml.versions),
+			strconv.Itoa(ml.releases),
+			ml.first.Format(time.RFC3339),
+			ml.last.Format(time.RFC3339),
+			days(ml.last.Sub(ml.first)),
+			cadence,
+			since,
+			strconv.FormatInt(a.deps.count[ml.module], 10),
+		}
+		rows = append(rows, row)
+		if a.now.Sub(ml.last) > a.abandoned && a.deps.count[ml.module] > 0 {
+			abandonedRows = append(abandonedRows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i][0] < rows[j][0]
+	})
+	sort.SliceStable(abandonedRows, func(i, j int) bool {
+		return a.deps.count[abandonedRows[i][0]] > a.deps.count[abandonedRows[j][0]]
+	})
+
+	err := writeTable("lifecycle", header, rows)
+	if err != nil {
+		return err
+	}
+	return writeTable("lifecycle-abandoned", header, abandonedRows)
+}
+
+// days formats a duration as fractional days
+func days(d time.Duration) string {
+	return strconv.FormatFloat(d.Hours()/24, 'f', 1, 64)
+}
@@ -2,21 +2,26 @@ package main
 
 import (
 	"bytes"
-	"encoding/csv"
+	"context"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	_ "net/http/pprof"
 
 	"go.seankhliao.com/gomodstats/v2/pb"
+	"golang.org/x/mod/module"
 	"golang.org/x/mod/semver"
 	"google.golang.org/protobuf/proto"
 )
@@ -26,8 +31,45 @@ const (
 	proxyURL = "https://proxy.golang.org"
 
 	chkptIndex = "index.pb"
+	chkptGone  = "gone.pb"
 
 	limit = 10
+
+	// drainTimeout is how long in-flight work has to finish after a shutdown signal
+	drainTimeout = time.Minute
+	// chkptInterval is how often a crawl saves gone.pb when -progress is 0
+	chkptInterval = 15 * time.Second
+)
+
+var (
+	reports = flag.String("reports", "timeofday,weekhour,timeseries", "comma separated reports to run, or all")
+	policy  = flag.String("select", "max", "module versions reported on: all, max, latest-release, latest-prerelease, first")
+	asof    = &dateFlag{}
+
+	interval = flag.String("interval", "day", "time series bucket interval: hour, day, week, month")
+	groupBy  = flag.String("by", "", "time series and heatmap dimension: host, major, delay")
+
+	metrics = flag.String("metric", "tokens,idents", "histogram metrics, comma separated numeric query expressions")
+	binning = flag.String("bins", "log", "histogram binning: linear, log, quantile")
+	nbins   = flag.Int("nbins", 20, "histogram bins")
+
+	top       = flag.Int("top", 100, "entries to compare in diff rankings")
+	abandoned = flag.Duration("abandoned", 2*365*24*time.Hour, "time since last release before a module is considered abandoned")
+
+	fields     = flag.String("fields", "path,version", "query output columns, comma separated expressions")
+	sortBy     = flag.String("sort", "key", "key count table order: key (numeric and semver aware), value (descending)")
+	maxRows    = flag.Int("limit", 0, "key count tables keep the first n rows after sorting, 0 for all")
+	cumulative = flag.Bool("cumulative", false, "add percent and cumulative percent columns to key count tables")
+	headers    = flag.Bool("header", false, "write a header row to key count csv tables")
+	charts     = flag.Bool("charts", false, "also write tables with a count column as svg charts")
+	format     = flag.String("format", "csv", "output formats, comma separated: csv, json, jsonl, md. query takes one, written to stdout")
+
+	addr = flag.String("addr", ":8080", "serve listen address")
+
+	progress = flag.Duration("progress", 15*time.Second, "interval between crawl progress lines and gone.pb checkpoints, 0 to only print at the end. metrics are on :6060/metrics")
+
+	goimportDir = flag.String("goimport-dir", "", "directory of cached go-get=1 html pages, named as path with / replaced by --")
+	goimportURL = flag.String("goimport-url", "", "stand-in server for go-get=1 html pages, queried as {url}/{path}?go-get=1")
 )
 
 var (
@@ -42,10 +84,55 @@ var (
 )
 
 //go:generate protoc -I=pb --go_out=pb pb/index.proto
+func init() {
+	flag.Var(asof, "asof", "only use index records published by the end of this day, 2006-01-02")
+}
+
 func main() {
-	go func() {
-		log.Println(http.ListenAndServe(":6060", nil))
-	}()
+	flag.Parse()
+	err := checkFormats(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *sortBy != "key" && *sortBy != "value" {
+		log.Fatalf("unknown sort %q, have key,value", *sortBy)
+	}
+
+	switch flag.Arg(0) {
+	case "diff":
+		diff(flag.Arg(1), flag.Arg(2), *top, *policy)
+		return
+	case "query":
+		query(flag.Arg(1), *fields, *format, *policy)
+		return
+	case "export":
+		export(flag.Arg(1), flag.Arg(2), *policy)
+		return
+	case "report":
+		if flag.Arg(1) != "html" {
+			log.Fatalf("unknown report output %q, have html", flag.Arg(1))
+		}
+		dir := flag.Arg(2)
+		if dir == "" {
+			dir = "site"
+		}
+		reportHTML(dir, *policy)
+		return
+	case "serve":
+		serve(*addr, *policy)
+		return
+	case "crawl":
+		go serveDebug()
+		ctx := shutdownContext()
+		pbi, err := Index(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		Modules(ctx, pbi)
+		return
+	}
+
+	go serveDebug()
 
 	// f, err := os.Create("error.log")
 	// if err != nil {
@@ -54,216 +141,417 @@ func main() {
 	// defer f.Close()
 	// log.SetOutput(io.MultiWriter(os.Stdout, f))
 
-	pbi, err := Index()
+	ctx := shutdownContext()
+	pbi, err := Index(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	aggs, err := aggregators(*reports)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = aggregate(asOf(pbi, asof.Time), aggs, *policy)
 	if err != nil {
 		log.Fatal(err)
 	}
-	// Modules(pbi)
+}
+
+type timeofdayAggregator struct {
+	s [60 * 24]int
+}
 
-	// idx := index()
-	// hosting(idx)
-	// versions(idx)
+func (a *timeofdayAggregator) Name() string { return "timeofday" }
 
-	// latest(idx)
-	// whousesweirdcaps()
-	timeofday(pbi)
+func (a *timeofdayAggregator) Record(r *pb.IndexRecord) error {
+	t, err := time.Parse(time.RFC3339Nano, r.Timestamp)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	a.s[t.Hour()*60+t.Minute()]++
+	return nil
 }
 
-func timeofday(pbi *pb.Index) {
-	s := make([]int, 60*24)
-	for _, r := range pbi.Records {
-		t, err := time.Parse(time.RFC3339Nano, r.Timestamp)
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-		s[t.Hour()*60+t.Minute()]++
+func (a *timeofdayAggregator) Write() error {
+	rows := make([][]string, 0, len(a.s))
+	for d, c := range a.s {
+		rows = append(rows, []string{fmt.Sprintf("%02d:%02d", d/60, d%60), strconv.Itoa(c)})
 	}
-	f, err := os.Create("timeofday.csv")
+	return writeOutput(table{name: "timeofday", header: []string{"time", "count:int"}, rows: rows, headless: true})
+}
+
+// weekhourAggregator writes a day of week by hour of day (UTC) publish heatmap,
+// one block of rows per dimension key
+type weekhourAggregator struct {
+	dim string
+	s   map[string]*[7][24]int64
+}
+
+func newWeekhourAggregator(dim string) (*weekhourAggregator, error) {
+	err := checkDimension(dim)
 	if err != nil {
-		log.Fatal(err)
-	}
-	w := csv.NewWriter(f)
-	for d, c := range s {
-		w.Write([]string{fmt.Sprintf("%02d:%02d", d/60, d%60), strconv.Itoa(c)})
+		return nil, fmt.Errorf("newWeekhourAggregator: %w", err)
 	}
-	w.Flush()
-	f.Close()
+	return &weekhourAggregator{
+		dim: dim,
+		s:   make(map[string]*[7][24]int64),
+	}, nil
 }
 
-func whousesweirdcaps() {
-	fis, err := ioutil.ReadDir("mods")
+func (a *weekhourAggregator) Name() string { return "weekhour" }
+
+func (a *weekhourAggregator) Record(r *pb.IndexRecord) error {
+	t, err := time.Parse(time.RFC3339Nano, r.Timestamp)
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
+		return nil
 	}
-	for _, fi := range fis {
-		if fi.IsDir() {
-			continue
-		}
+	k := dimension(r, a.dim)
+	if a.s[k] == nil {
+		a.s[k] = &[7][24]int64{}
+	}
+	// start weeks on Monday
+	a.s[k][(int(t.Weekday())+6)%7][t.Hour()]++
+	return nil
+}
 
-		b, err := ioutil.ReadFile("mods/" + fi.Name())
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-		var mv pb.ModuleVersion
-		err = proto.Unmarshal(b, &mv)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if _, ok := mv.Idents["iNdEx"]; ok {
-			fmt.Println("iNdEx: ", fi.Name())
-		}
-		if _, ok := mv.Idents["dAtA"]; ok {
-			fmt.Println("dAtA: ", fi.Name())
+func (a *weekhourAggregator) Write() error {
+	keys := make([]string, 0, len(a.s))
+	for k := range a.s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fn := "weekhour"
+	if a.dim != "" {
+		fn = "weekhour-" + a.dim
+	}
+	header := []string{"key", "weekday"}
+	for h := 0; h < 24; h++ {
+		header = append(header, fmt.Sprintf("%02d:int", h))
+	}
+	var rows [][]string
+	for _, k := range keys {
+		for d, hs := range a.s[k] {
+			row := []string{k, time.Weekday((d + 1) % 7).String()}
+			for _, c := range hs {
+				row = append(row, strconv.FormatInt(c, 10))
+			}
+			rows = append(rows, row)
 		}
 	}
+	return writeTable(fn, header, rows)
 }
 
-func latest(idx map[string][]pb.IndexRecord) {
-	govers := make(map[string]int64)
-	requires := make(map[string]int64)
-	replaces := make(map[string]int64)
-	excludes := make(map[string]int64)
-	tokens := make(map[string]int64)
-	tokendist := make(map[string]int64)
-	idents := make(map[string]int64)
-	identdist := make(map[string]int64)
+type latestAggregator struct {
+	govers    map[string]int64
+	requires  map[string]int64
+	replaces  map[string]int64
+	excludes  map[string]int64
+	tokens    map[string]int64
+	tokendist map[string]int64
+	idents    map[string]int64
+	identdist map[string]int64
+}
 
-	for m := range idx {
-		ir := idx[m][len(idx[m])-1]
+func newLatestAggregator() *latestAggregator {
+	return &latestAggregator{
+		govers:    make(map[string]int64),
+		requires:  make(map[string]int64),
+		replaces:  make(map[string]int64),
+		excludes:  make(map[string]int64),
+		tokens:    make(map[string]int64),
+		tokendist: make(map[string]int64),
+		idents:    make(map[string]int64),
+		identdist: make(map[string]int64),
+	}
+}
 
-		fn := fmt.Sprintf("%s/%s@%s.pb", "mods", strings.ReplaceAll(ir.Path, "/", "--"), ir.Version)
-		b, err := ioutil.ReadFile(fn)
-		if err != nil {
-			log.Println(err)
-			continue
-		}
+func (a *latestAggregator) Name() string { return "latest" }
+
+func (a *latestAggregator) Selected(ir *pb.IndexRecord, mv *pb.ModuleVersion) error {
+	a.govers[mv.Go]++
+	a.requires[strconv.Itoa(len(mv.Requires))]++
+	a.replaces[strconv.Itoa(len(mv.Replaces))]++
+	a.excludes[strconv.Itoa(len(mv.Excludes))]++
+	var t int64
+	for tk, c := range mv.Tokens {
+		t += c
+		a.tokens[tk] += c
+	}
+	a.tokendist[strconv.FormatInt(t, 10)]++
+	var i int64
+	for id, c := range mv.Idents {
+		i += c
+		a.idents[id] += c
+	}
+	a.identdist[strconv.FormatInt(i, 10)]++
+	return nil
+}
 
-		var mv pb.ModuleVersion
-		err = proto.Unmarshal(b, &mv)
+func (a *latestAggregator) Write() error {
+	for _, m := range []struct {
+		name string
+		m    map[string]int64
+	}{
+		{"latest-govers", a.govers},
+		{"latest-requires", a.requires},
+		{"latest-replaces", a.replaces},
+		{"latest-excludes", a.excludes},
+		{"latest-tokenpop", a.tokens},
+		{"latest-tokencount", a.tokendist},
+		{"latest-identpop", a.idents},
+		{"latest-identcount", a.identdist},
+	} {
+		err := writeMap(m.name, m.m)
 		if err != nil {
-			log.Fatal(err)
-		}
-		govers[mv.Go]++
-		requires[strconv.Itoa(len(mv.Requires))]++
-		replaces[strconv.Itoa(len(mv.Replaces))]++
-		excludes[strconv.Itoa(len(mv.Excludes))]++
-		var t int64
-		for tk, c := range mv.Tokens {
-			t += c
-			tokens[tk] += c
+			return err
 		}
-		tokendist[strconv.FormatInt(t, 10)]++
-		var i int64
-		for id, c := range mv.Idents {
-			i += c
-			idents[id] += c
-		}
-		identdist[strconv.FormatInt(i, 10)]++
 	}
+	return nil
+}
 
-	mapcsv("latest-govers.csv", govers)
-	mapcsv("latest-requires.csv", requires)
-	mapcsv("latest-replaces.csv", replaces)
-	mapcsv("latest-excludes.csv", excludes)
-	mapcsv("latest-tokenpop.csv", tokens)
-	mapcsv("latest-tokencount.csv", tokendist)
-	mapcsv("latest-identpop.csv", idents)
-	mapcsv("latest-identcount.csv", identdist)
+type versionsAggregator struct {
+	modvers    map[string]int64
+	kinds      map[string]int64
+	prerel     map[string]int64
+	pseudobase map[string]int64
+	delays     map[string]int64
+	delaydays  map[string]int64
+}
 
+func newVersionsAggregator() *versionsAggregator {
+	return &versionsAggregator{
+		modvers:    make(map[string]int64),
+		kinds:      make(map[string]int64),
+		prerel:     make(map[string]int64),
+		pseudobase: make(map[string]int64),
+		delays:     make(map[string]int64),
+		delaydays:  make(map[string]int64),
+	}
 }
 
-func versions(idx map[string][]pb.IndexRecord) {
-	modvers := make(map[string]int64)
-	prerel := make(map[string]int64)
-	for _, irs := range idx {
-		modvers[strconv.Itoa(len(irs))]++
-		for _, ir := range irs {
-			prs := strings.Split(ir.Version, "-")
-			for i := 1; i < len(prs); i++ {
-				prerel[prs[i]]++
+func (a *versionsAggregator) Name() string { return "versions" }
+
+func (a *versionsAggregator) Module(m string, irs []*pb.IndexRecord) error {
+	a.modvers[strconv.Itoa(len(irs))]++
+	for _, ir := range irs {
+		kind := versionKind(ir.Version)
+		a.kinds[kind]++
+		switch kind {
+		case "prerelease":
+			for _, w := range strings.Split(strings.TrimPrefix(semver.Prerelease(ir.Version), "-"), ".") {
+				a.prerel[w]++
 			}
+		case "pseudo", "pseudo-base":
+			base, err := module.PseudoVersionBase(ir.Version)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if base == "" {
+				base = "none"
+			}
+			a.pseudobase[base]++
+
+			d, err := pseudoDelay(ir)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			a.delays[delayBucket(d)]++
+			a.delaydays[strconv.Itoa(int(d.Hours()/24))]++
 		}
 	}
+	return nil
+}
 
-	mapcsv("versions-dist.csv", modvers)
-	mapcsv("versions-prerelwords", prerel)
-}
-
-func hosting(idx map[string][]pb.IndexRecord) {
-	host := make(map[string]int64)
-	scm := make(map[string]int64)
-	vanity := make(map[string]int64)
-
-	hc := map[string]bool{
-		"github.com":         true,
-		"bitbucket.org":      true,
-		"hub.jazz.net":       true,
-		"git.apache.org":     true,
-		"git.openstack.org":  true,
-		"chiselapp.com":      true,
-		"code.launchpad.net": true,
-	}
-
-	for k := range idx {
-		h := strings.SplitN(k, "/", 2)
-		host[h[0]]++
-		if !hc[h[0]] {
-			if strings.Contains(k, ".git") {
-				scm["git"]++
-			} else if strings.Contains(k, ".hg") {
-				scm["hg"]++
-			} else if strings.Contains(k, ".svn") {
-				scm["svn"]++
-			} else if strings.Contains(k, ".bzr") {
-				scm["bzr"]++
-			} else if strings.Contains(k, ".fossil") {
-				scm["fossil"]++
-			} else {
-				vanity[h[0]]++
-			}
+func (a *versionsAggregator) Write() error {
+	for _, m := range []struct {
+		name string
+		m    map[string]int64
+	}{
+		{"versions-dist", a.modvers},
+		{"versions-kinds", a.kinds},
+		{"versions-prerelwords", a.prerel},
+		{"versions-pseudobase", a.pseudobase},
+		{"versions-pseudodelay", a.delays},
+		{"versions-pseudodelay-days", a.delaydays},
+	} {
+		err := writeMap(m.name, m.m)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// versionKind classifies a version as
+// release, prerelease, pseudo (no base version) or pseudo-base
+func versionKind(v string) string {
+	switch {
+	case module.IsPseudoVersion(v):
+		// no base for vX.0.0-yyyymmddhhmmss-abcdefabcdef
+		if base, err := module.PseudoVersionBase(v); err == nil && base == "" {
+			return "pseudo"
 		}
+		return "pseudo-base"
+	case semver.Prerelease(v) != "":
+		return "prerelease"
 	}
-	mapcsv("hosting-all.csv", host)
-	mapcsv("hosting-scm.csv", scm)
-	mapcsv("hosting-vanity", vanity)
+	return "release"
 }
 
-func mapcsv(fn string, m map[string]int64) {
-	f, err := os.Create(fn)
+// pseudoDelay is the time between the commit embedded in a pseudo-version
+// and its appearance in the index
+func pseudoDelay(ir *pb.IndexRecord) (time.Duration, error) {
+	ct, err := module.PseudoVersionTime(ir.Version)
 	if err != nil {
-		log.Fatal(err)
+		return 0, fmt.Errorf("pseudoDelay %s %s: %w", ir.Path, ir.Version, err)
 	}
-	defer f.Close()
+	it, err := time.Parse(time.RFC3339Nano, ir.Timestamp)
+	if err != nil {
+		return 0, fmt.Errorf("pseudoDelay %s %s: %w", ir.Path, ir.Version, err)
+	}
+	return it.Sub(ct), nil
+}
+
+type hostingAggregator struct {
+	r       *resolver
+	host    map[string]int64
+	fams    map[string]bool
+	scm     map[string]int64
+	vanity  map[string]int64
+	methods map[string]int64
+	rows    [][]string
+}
 
-	a := make([][]string, 0, len(m))
-	for k, v := range m {
-		a = append(a, []string{k, strconv.FormatInt(int64(v), 10)})
+func newHostingAggregator(r *resolver) *hostingAggregator {
+	return &hostingAggregator{
+		r:       r,
+		host:    make(map[string]int64),
+		fams:    make(map[string]bool),
+		scm:     make(map[string]int64),
+		vanity:  make(map[string]int64),
+		methods: make(map[string]int64),
+	}
+}
+
+func (a *hostingAggregator) Name() string { return "hosting" }
+
+func (a *hostingAggregator) Module(k string, irs []*pb.IndexRecord) error {
+	h := strings.SplitN(k, "/", 2)
+	a.host[h[0]]++
+	f, _ := family(k)
+	a.fams[f] = true
+
+	rr, err := a.r.resolve(k)
+	if err != nil {
+		log.Println(err)
+	}
+	if rr.VCS == "" {
+		rr.VCS = "unknown"
+	}
+	a.scm[rr.VCS]++
+	a.methods[rr.Method]++
+	if rr.Method != "known" {
+		a.vanity[h[0]]++
 	}
-	sort.Slice(a, func(i, j int) bool {
-		return a[i][0] < a[j][0]
+	a.rows = append(a.rows, []string{k, rr.Method, rr.VCS, rr.Root, rr.Repo})
+	return nil
+}
+
+func (a *hostingAggregator) Write() error {
+	hostfam := make(map[string]int64)
+	for f := range a.fams {
+		hostfam[strings.SplitN(f, "/", 2)[0]]++
+	}
+	sort.Slice(a.rows, func(i, j int) bool {
+		return a.rows[i][0] < a.rows[j][0]
 	})
+	for _, m := range []struct {
+		name string
+		m    map[string]int64
+	}{
+		{"hosting-all", a.host},
+		{"hosting-families", hostfam},
+		{"hosting-scm", a.scm},
+		{"hosting-vanity", a.vanity},
+		{"hosting-methods", a.methods},
+	} {
+		err := writeMap(m.name, m.m)
+		if err != nil {
+			return err
+		}
+	}
+	return writeTable("hosting-roots", []string{"module", "method", "vcs", "root", "repo"}, a.rows)
+}
 
-	w := csv.NewWriter(f)
-	defer w.Flush()
-	w.WriteAll(a)
+// dateFlag is a 2006-01-02 formatted date
+type dateFlag struct {
+	time.Time
 }
 
-func index() map[string][]pb.IndexRecord {
+func (d *dateFlag) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.Format("2006-01-02")
+}
+
+func (d *dateFlag) Set(s string) error {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return err
+	}
+	d.Time = t
+	return nil
+}
+
+// loadModuleVersion reads the stored results of getMod
+func loadModuleVersion(m, v string) (*pb.ModuleVersion, error) {
+	return readModuleVersion(".", m, v)
+}
+
+// modFile is where getMod stores the results for a module version in a dataset directory
+func modFile(dir, m, v string) string {
+	return fmt.Sprintf("%s/%s/%s@%s.pb", dir, "mods", strings.ReplaceAll(m, "/", "--"), v)
+}
+
+// readModuleVersion reads stored getMod results from a dataset directory
+func readModuleVersion(dir, m, v string) (*pb.ModuleVersion, error) {
+	b, err := ioutil.ReadFile(modFile(dir, m, v))
+	if err != nil {
+		return nil, fmt.Errorf("loadModuleVersion read %s %s: %w", m, v, err)
+	}
+	var mv pb.ModuleVersion
+	err = proto.Unmarshal(b, &mv)
+	if err != nil {
+		return nil, fmt.Errorf("loadModuleVersion unmarshal %s %s: %w", m, v, err)
+	}
+	return &mv, nil
+}
+
+// readIndex reads the index checkpoint from a dataset directory
+func readIndex(dir string) (*pb.Index, error) {
 	var pbi pb.Index
-	b, err := ioutil.ReadFile(chkptIndex)
+	b, err := ioutil.ReadFile(filepath.Join(dir, chkptIndex))
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("readIndex read %s: %w", dir, err)
 	}
 	err = proto.Unmarshal(b, &pbi)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("readIndex unmarshal %s: %w", dir, err)
 	}
+	return &pbi, nil
+}
 
-	m := make(map[string][]pb.IndexRecord, 180000)
+// groupIndex groups index records by module path, in semver order
+func groupIndex(pbi *pb.Index) map[string][]*pb.IndexRecord {
+	m := make(map[string][]*pb.IndexRecord, 180000)
 	for _, ir := range pbi.Records {
-		m[ir.Path] = append(m[ir.Path], *ir)
+		m[ir.Path] = append(m[ir.Path], ir)
 	}
 	for k := range m {
 		sort.Slice(m[k], func(i, j int) bool {
@@ -273,3 +561,23 @@ func index() map[string][]pb.IndexRecord {
 
 	return m
 }
+
+// serveDebug serves pprof and /metrics on :6060
+func serveDebug() {
+	log.Println(http.ListenAndServe(":6060", nil))
+}
+
+// shutdownContext is canceled on the first SIGINT or SIGTERM,
+// the signal after that exits as usual
+func shutdownContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-c
+		signal.Stop(c)
+		log.Printf("received %v, finishing in-flight work, signal again to exit now", s)
+		cancel()
+	}()
+	return ctx
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// crawl metrics, served in the prometheus text format on /metrics
+var (
+	crawlModules  = newMetricVec("gomodstats_crawl_modules", "Modules in the index to crawl.", "gauge", "")
+	crawlVersions = newMetricVec("gomodstats_crawl_module_versions", "Module versions in the index to crawl.", "gauge", "")
+	crawlDone     = newMetricVec("gomodstats_crawl_done_total", "Module versions fetched and analyzed.", "counter", "")
+	crawlGone     = newMetricVec("gomodstats_crawl_gone_total", "Module versions the proxy no longer serves.", "counter", "")
+	crawlErrors   = newMetricVec("gomodstats_crawl_errors_total", "Module versions that failed, by where they failed.", "counter", "category")
+	crawlInflight = newMetricVec("gomodstats_crawl_inflight", "Module versions being fetched.", "gauge", "")
+	crawlBytes    = newMetricVec("gomodstats_crawl_download_bytes_total", "Bytes downloaded from the proxy, by file kind.", "counter", "kind")
+	crawlLatency  = newHistogramVec("gomodstats_crawl_request_duration_seconds", "Proxy request time including reading the body, by file kind.", "kind",
+		[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60})
+)
+
+// metricRegistry is written in registration order
+var metricRegistry []interface{ writeMetric(io.Writer) }
+
+func init() {
+	// main serves http.DefaultServeMux on :6060
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "text/plain; version=0.0.4")
+		for _, m := range metricRegistry {
+			m.writeMetric(w)
+		}
+	})
+}
+
+// metricVec is a counter or gauge, optionally split by the values of one label
+type metricVec struct {
+	name, help, typ, label string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newMetricVec(name, help, typ, label string) *metricVec {
+	m := &metricVec{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		label:  label,
+		values: make(map[string]float64),
+	}
+	metricRegistry = append(metricRegistry, m)
+	return m
+}
+
+func (m *metricVec) add(lv string, d float64) {
+	m.mu.Lock()
+	m.values[lv] += d
+	m.mu.Unlock()
+}
+
+func (m *metricVec) set(lv string, v float64) {
+	m.mu.Lock()
+	m.values[lv] = v
+	m.mu.Unlock()
+}
+
+func (m *metricVec) value(lv string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.values[lv]
+}
+
+// total sums over all label values
+func (m *metricVec) total() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var t float64
+	for _, v := range m.values {
+		t += v
+	}
+	return t
+}
+
+func (m *metricVec) writeMetric(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+	if m.label == "" {
+		fmt.Fprintf(w, "%s %s\n", m.name, formatMetric(m.values[""]))
+		return
+	}
+	for _, lv := range sortedLabels(m.values) {
+		fmt.Fprintf(w, "%s{%s} %s\n", m.name, labelPair(m.label, lv), formatMetric(m.values[lv]))
+	}
+}
+
+// histogramVec counts observations into cumulative buckets,
+// split by the values of one label
+type histogramVec struct {
+	name, help, label string
+	buckets           []float64
+
+	mu   sync.Mutex
+	data map[string]*histogramData
+}
+
+type histogramData struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogramVec(name, help, label string, buckets []float64) *histogramVec {
+	h := &histogramVec{
+		name:    name,
+		help:    help,
+		label:   label,
+		buckets: buckets,
+		data:    make(map[string]*histogramData),
+	}
+	metricRegistry = append(metricRegistry, h)
+	return h
+}
+
+func (h *histogramVec) observe(lv string, v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	d, ok := h.data[lv]
+	if !ok {
+		d = &histogramData{counts: make([]uint64, len(h.buckets))}
+		h.data[lv] = d
+	}
+	for i, le := range h.buckets {
+		if v <= le {
+			d.counts[i]++
+		}
+	}
+	d.sum += v
+	d.count++
+}
+
+func (h *histogramVec) writeMetric(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	lvs := make([]string, 0, len(h.data))
+	for lv := range h.data {
+		lvs = append(lvs, lv)
+	}
+	sort.Strings(lvs)
+	for _, lv := range lvs {
+		d, l := h.data[lv], labelPair(h.label, lv)
+		for i, le := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", h.name, l, formatMetric(le), d.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.name, l, d.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, l, formatMetric(d.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, l, d.count)
+	}
+}
+
+func sortedLabels(m map[string]float64) []string {
+	lvs := make([]string, 0, len(m))
+	for lv := range m {
+		lvs = append(lvs, lv)
+	}
+	sort.Strings(lvs)
+	return lvs
+}
+
+func labelPair(name, value string) string {
+	return name + `="` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+func formatMetric(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// crawlError is a getMod failure at a known step,
+// category names the step in metrics, ex modfile_get or module_analyze
+type crawlError struct {
+	category string
+	err      error
+}
+
+func crawlErrorf(category, format string, args ...interface{}) error {
+	return &crawlError{category, fmt.Errorf(format, args...)}
+}
+
+func (e *crawlError) Error() string { return e.err.Error() }
+func (e *crawlError) Unwrap() error { return e.err }
+
+// errorCategory names the step getMod failed at, other if it is not known
+func errorCategory(err error) string {
+	var ce *crawlError
+	if errors.As(err, &ce) {
+		return ce.category
+	}
+	return "other"
+}
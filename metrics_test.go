@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestErrorCategory(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{crawlErrorf("modfile_get", "modfile get %s: %w", "m", errors.New("timeout")), "modfile_get"},
+		{fmt.Errorf("wrapped: %w", crawlErrorf("module_analyze", "module analyze")), "module_analyze"},
+		{errors.New("modfile get m v: timeout"), "other"},
+		{fmt.Errorf("buffer assert failed, type=%T", 1), "other"},
+	}
+	for _, tt := range tests {
+		if got := errorCategory(tt.err); got != tt.want {
+			t.Errorf("errorCategory(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+
+	base := errors.New("connection reset")
+	err := crawlErrorf("module_read", "module read m v: %w", base)
+	if !errors.Is(err, base) || err.Error() != "module read m v: connection reset" {
+		t.Errorf("crawlErrorf = %v, want it to wrap %v", err, base)
+	}
+}
+
+func TestMetricVec(t *testing.T) {
+	m := &metricVec{name: "test_total", help: "Test.", typ: "counter", label: "kind", values: make(map[string]float64)}
+	m.add("zip", 2)
+	m.add(`a"b`, 1)
+	m.add("zip", 0.5)
+	var b strings.Builder
+	m.writeMetric(&b)
+	want := "# HELP test_total Test.\n# TYPE test_total counter\n" +
+		"test_total{kind=\"a\\\"b\"} 1\ntest_total{kind=\"zip\"} 2.5\n"
+	if b.String() != want || m.total() != 3.5 {
+		t.Errorf("writeMetric = %q, total %v, want %q", b.String(), m.total(), want)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.seankhliao.com/gomodstats/v2/pb"
+)
+
+// monoreposAggregator reports repositories holding more than one module family,
+// found from indexed module paths sharing a repo root
+// and from modules under the root that are only seen in sibling requires and replaces
+// (module zips leave out nested modules, so they can't be seen directly),
+// along with replace directives pointing between sibling modules
+type monoreposAggregator struct {
+	r          *resolver
+	repoOf     map[string]string
+	indexed    map[string]map[string]bool
+	referenced map[string]map[string]bool
+	replaces   map[string][]*pb.Replace
+}
+
+func newMonoreposAggregator(r *resolver) *monoreposAggregator {
+	return &monoreposAggregator{
+		r:          r,
+		repoOf:     make(map[string]string),
+		indexed:    make(map[string]map[string]bool),
+		referenced: make(map[string]map[string]bool),
+		replaces:   make(map[string][]*pb.Replace),
+	}
+}
+
+func (a *monoreposAggregator) Name() string { return "monorepos" }
+
+func (a *monoreposAggregator) Module(m string, irs []*pb.IndexRecord) error {
+	repo := a.r.repo(m)
+	if a.indexed[repo] == nil {
+		a.indexed[repo] = make(map[string]bool)
+		a.referenced[repo] = make(map[string]bool)
+	}
+	a.indexed[repo][m] = true
+	a.repoOf[m] = repo
+	return nil
+}
+
+func (a *monoreposAggregator) Selected(ir *pb.IndexRecord, mv *pb.ModuleVersion) error {
+	repo := a.repoOf[ir.Path]
+	for _, r := range mv.Requires {
+		a.reference(repo, r.Version.Module)
+	}
+	for _, r := range mv.Replaces {
+		if localReplace(r) {
+			a.reference(repo, r.Old.Module)
+		}
+	}
+	a.replaces[ir.Path] = mv.Replaces
+	return nil
+}
+
+// reference records a module path required or replaced from within repo,
+// it is a module in the repo if the path is under the repo root
+func (a *monoreposAggregator) reference(repo, m string) {
+	if m == repo || strings.HasPrefix(m, repo+"/") {
+		a.referenced[repo][m] = true
+	}
+}
+
+func (a *monoreposAggregator) Write() error {
+	dist := make(map[string]int64)
+	var rows [][]string
+	for repo, ms := range a.indexed {
+		all := make(map[string]bool, len(ms))
+		for m := range ms {
+			all[m] = true
+		}
+		var unindexed int
+		for m := range a.referenced[repo] {
+			if !all[m] {
+				all[m] = true
+				unindexed++
+			}
+		}
+		// major versions of one module (ex a/b and a/b/v2) don't make a monorepo
+		fams := make(map[string]bool)
+		for m := range all {
+			prefix, _ := family(m)
+			fams[prefix] = true
+		}
+		dist[strconv.Itoa(len(fams))]++
+		if len(fams) < 2 {
+			continue
+		}
+
+		var replaces int
+		for m := range ms {
+			for _, rep := range a.replaces[m] {
+				if siblingReplace(rep, all) {
+					replaces++
+				}
+			}
+		}
+
+		names := make([]string, 0, len(all))
+		for m := range all {
+			names = append(names, m)
+		}
+		sort.Strings(names)
+		rows = append(rows, []string{repo, strconv.Itoa(len(fams)), strconv.Itoa(len(all)), strconv.Itoa(len(ms)), strconv.Itoa(unindexed), strconv.Itoa(replaces), strings.Join(names, " ")})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i][0] < rows[j][0]
+	})
+
+	err := writeMap("monorepos-dist", dist)
+	if err != nil {
+		return err
+	}
+	return writeTable("monorepos", []string{"repo", "families:int", "modules:int", "indexed:int", "unindexed:int", "siblingreplaces:int", "paths"}, rows)
+}
+
+// siblingReplace reports whether a replace swaps a sibling module
+// for another sibling or for a relative directory
+func siblingReplace(rep *pb.Replace, siblings map[string]bool) bool {
+	if !siblings[rep.Old.Module] {
+		return false
+	}
+	return localReplace(rep) || siblings[rep.New.Module]
+}
+
+// localReplace reports whether a replace points to a relative directory
+func localReplace(rep *pb.Replace) bool {
+	n := rep.New.Module
+	return strings.HasPrefix(n, "./") || strings.HasPrefix(n, "../")
+}
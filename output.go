@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// outputFormats are the formats a table can be written in,
+// also used as file extensions
+var outputFormats = []string{"csv", "json", "jsonl", "md"}
+
+// table is a report output with typed columns.
+// Header names can be suffixed with :int, :float or :bool,
+// those columns are written as numbers or booleans where the format has them
+type table struct {
+	name   string
+	header []string
+	rows   [][]string
+	// headless tables are written to csv without a header row
+	headless bool
+}
+
+func (t table) columns() (names, types []string) {
+	for _, h := range t.header {
+		i := strings.LastIndex(h, ":")
+		if i < 0 || (h[i+1:] != "int" && h[i+1:] != "float" && h[i+1:] != "bool") {
+			names, types = append(names, h), append(types, "string")
+			continue
+		}
+		names, types = append(names, h[:i]), append(types, h[i+1:])
+	}
+	return names, types
+}
+
+// checkFormats validates a comma separated list of output formats
+func checkFormats(formats string) error {
+	for _, f := range strings.Split(formats, ",") {
+		ok := false
+		for _, of := range outputFormats {
+			ok = ok || f == of
+		}
+		if !ok {
+			return fmt.Errorf("checkFormats: unknown format %q, have %s", f, strings.Join(outputFormats, ","))
+		}
+	}
+	return nil
+}
+
+// writeTable writes a table to files named after it, one per format in -format
+func writeTable(name string, header []string, rows [][]string) error {
+	return writeOutput(table{name: name, header: header, rows: rows})
+}
+
+// writeMap writes a key count table, ordered by -sort and truncated to -limit rows,
+// with percentage columns if -cumulative is set.
+// It is headless in csv as it has always been, unless -header is set
+func writeMap(name string, m map[string]int64) error {
+	var total int64
+	keys := make([]string, 0, len(m))
+	for k, v := range m {
+		keys = append(keys, k)
+		total += v
+	}
+	sortKeys(keys, m, *sortBy)
+
+	header := []string{"key", "count:int"}
+	if *cumulative {
+		header = append(header, "percent:float", "cumulative:float")
+	}
+	rows := make([][]string, 0, len(keys))
+	var cum int64
+	for i, k := range keys {
+		if *maxRows > 0 && i >= *maxRows {
+			break
+		}
+		row := []string{k, strconv.FormatInt(m[k], 10)}
+		if *cumulative {
+			cum += m[k]
+			row = append(row, percent(m[k], total), percent(cum, total))
+		}
+		rows = append(rows, row)
+	}
+	return writeOutput(table{name: name, header: header, rows: rows, headless: !*headers})
+}
+
+// sortKeys orders keys by compareKeys, or by descending value then key
+func sortKeys(keys []string, m map[string]int64, by string) {
+	sort.Slice(keys, func(i, j int) bool {
+		if by == "value" && m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return compareKeys(keys[i], keys[j]) < 0
+	})
+}
+
+// compareKeys orders empty keys first, then integers numerically,
+// then versions by semver, go versions like 1.13 included,
+// then everything else lexically.
+// Keys are compared by class first so the order is transitive
+// when classes are mixed, ex "1.13rc1" is not a version
+func compareKeys(a, b string) int {
+	ca, cb := keyClass(a), keyClass(b)
+	switch {
+	case ca.class != cb.class:
+		if ca.class < cb.class {
+			return -1
+		}
+		return 1
+	case ca.class == keyInt:
+		switch {
+		case ca.n < cb.n:
+			return -1
+		case ca.n > cb.n:
+			return 1
+		}
+		return 0
+	case ca.class == keyVersion:
+		if c := semver.Compare(ca.v, cb.v); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+const (
+	keyEmpty = iota
+	keyInt
+	keyVersion
+	keyOther
+)
+
+type classedKey struct {
+	class int
+	n     int64
+	// v is the key as a semver version
+	v string
+}
+
+func keyClass(k string) classedKey {
+	if k == "" {
+		return classedKey{class: keyEmpty}
+	}
+	if n, err := strconv.ParseInt(k, 10, 64); err == nil {
+		return classedKey{class: keyInt, n: n}
+	}
+	v := k
+	if !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	if semver.IsValid(v) {
+		return classedKey{class: keyVersion, v: v}
+	}
+	return classedKey{class: keyOther}
+}
+
+func percent(n, total int64) string {
+	if total == 0 {
+		return "0.00"
+	}
+	return strconv.FormatFloat(float64(n)*100/float64(total), 'f', 2, 64)
+}
+
+// tableSink, if set, receives tables instead of them being written to files
+var tableSink func(table)
+
+// writeOutput writes a table in each of the -format formats,
+// and as an svg chart if -charts is set
+func writeOutput(t table) error {
+	if tableSink != nil {
+		tableSink(t)
+		return nil
+	}
+	for _, format := range strings.Split(*format, ",") {
+		err := writeFile(t.name+"."+format, func(w io.Writer) error {
+			return t.write(w, format)
+		})
+		if err != nil {
+			return fmt.Errorf("writeOutput: %w", err)
+		}
+	}
+	if !*charts {
+		return nil
+	}
+	svg := tableChart(t)
+	if svg == nil {
+		return nil
+	}
+	err := ioutil.WriteFile(t.name+".svg", svg, 0o644)
+	if err != nil {
+		return fmt.Errorf("writeOutput: %w", err)
+	}
+	return nil
+}
+
+// write writes the table in one of outputFormats
+func (t table) write(w io.Writer, format string) error {
+	names, types := t.columns()
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		if !t.headless {
+			cw.Write(names)
+		}
+		cw.WriteAll(t.rows)
+		return cw.Error()
+
+	case "json", "jsonl":
+		sep, open, end := ",\n", "[\n", "\n]\n"
+		if format == "jsonl" {
+			sep, open, end = "\n", "", "\n"
+		}
+		if len(t.rows) == 0 {
+			open, end = strings.TrimSuffix(open, "\n"), strings.TrimPrefix(end, "\n")
+		}
+		_, err := io.WriteString(w, open)
+		for i, row := range t.rows {
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				_, err = io.WriteString(w, sep)
+			}
+			if err == nil {
+				_, err = io.WriteString(w, jsonObject(names, types, row))
+			}
+		}
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, end)
+		return err
+
+	case "md":
+		var b strings.Builder
+		b.WriteString("|")
+		for _, n := range names {
+			b.WriteString(" " + mdEscape(n) + " |")
+		}
+		b.WriteString("\n|")
+		for _, typ := range types {
+			if typ == "int" || typ == "float" {
+				b.WriteString(" ---: |")
+			} else {
+				b.WriteString(" --- |")
+			}
+		}
+		b.WriteString("\n")
+		for _, row := range t.rows {
+			b.WriteString("|")
+			for _, c := range row {
+				b.WriteString(" " + mdEscape(c) + " |")
+			}
+			b.WriteString("\n")
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	return fmt.Errorf("write: unknown format %q", format)
+}
+
+// jsonObject formats a row as an object with keys in column order,
+// empty typed values are null, ones that fail to parse are kept as strings
+func jsonObject(names, types, row []string) string {
+	var b strings.Builder
+	b.WriteString("{")
+	for i, c := range row {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		k, _ := json.Marshal(names[i])
+		b.Write(k)
+		b.WriteString(": ")
+		var v interface{} = c
+		if c == "" && types[i] != "string" {
+			v = nil
+		}
+		switch types[i] {
+		case "int":
+			if n, err := strconv.ParseInt(c, 10, 64); err == nil {
+				v = n
+			}
+		case "float":
+			if f, err := strconv.ParseFloat(c, 64); err == nil {
+				v = f
+			}
+		case "bool":
+			if t, err := strconv.ParseBool(c); err == nil {
+				v = t
+			}
+		}
+		jv, _ := json.Marshal(v)
+		b.Write(jv)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func mdEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestCompareKeys(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2", "10", -1},
+		{"-1", "0", -1},
+		{"10", "10", 0},
+		{"1.9", "1.13", -1},
+		{"v1.2.3", "v1.10.0", -1},
+		{"1.13", "v1.13", -1},
+		{"v1.0.0-rc1", "v1.0.0", -1},
+		{"1.13", "1.13rc1", -1},
+		{"1.13rc1", "1.9", 1},
+		{"10", "1.9", -1},
+		{"1.9", "", 1},
+		{"", "0", -1},
+		{"a", "b", -1},
+	}
+	for _, tt := range tests {
+		if got := compareKeys(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareKeys(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := compareKeys(tt.b, tt.a); got != -tt.want {
+			t.Errorf("compareKeys(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+
+	// every pair of a sorted list is in order
+	keys := []string{"1.13rc1", "v2.0.0", "go1.13", "1.9", "3", "1.13", "", "v1.13.1", "20", "none", "1.13beta1"}
+	sort.Slice(keys, func(i, j int) bool { return compareKeys(keys[i], keys[j]) < 0 })
+	for i := range keys {
+		for j := i + 1; j < len(keys); j++ {
+			if compareKeys(keys[i], keys[j]) > 0 {
+				t.Errorf("sorted %q, but %q > %q", keys, keys[i], keys[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.seankhliao.com/gomodstats/v2/pb"
+)
+
+// publishStats accumulates counts and publish times for a group of modules
+type publishStats struct {
+	repos       map[string]bool
+	modules     int
+	versions    int
+	first, last time.Time
+}
+
+func (s *publishStats) add(repo string, irs []*pb.IndexRecord) {
+	s.repos[repo] = true
+	s.modules++
+	s.versions += len(irs)
+	for _, ir := range irs {
+		t, err := time.Parse(time.RFC3339Nano, ir.Timestamp)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if s.first.IsZero() || t.Before(s.first) {
+			s.first = t
+		}
+		if t.After(s.last) {
+			s.last = t
+		}
+	}
+}
+
+// ownersAggregator aggregates modules by repository and by owner,
+// the first two elements of the repo root, ex github.com/golang
+type ownersAggregator struct {
+	r     *resolver
+	repos map[string]*publishStats
+	owns  map[string]*publishStats
+}
+
+func newOwnersAggregator(r *resolver) *ownersAggregator {
+	return &ownersAggregator{
+		r:     r,
+		repos: make(map[string]*publishStats),
+		owns:  make(map[string]*publishStats),
+	}
+}
+
+func (a *ownersAggregator) Name() string { return "owners" }
+
+func (a *ownersAggregator) Module(m string, irs []*pb.IndexRecord) error {
+	repo := a.r.repo(m)
+	own := owner(repo)
+	if a.repos[repo] == nil {
+		a.repos[repo] = &publishStats{repos: make(map[string]bool)}
+	}
+	if a.owns[own] == nil {
+		a.owns[own] = &publishStats{repos: make(map[string]bool)}
+	}
+	a.repos[repo].add(repo, irs)
+	a.owns[own].add(repo, irs)
+	return nil
+}
+
+func (a *ownersAggregator) Write() error {
+	rows := make([][]string, 0, len(a.repos))
+	multi := make(map[string]int64)
+	for repo, s := range a.repos {
+		multi[strconv.Itoa(s.modules)]++
+		rows = append(rows, []string{repo, owner(repo), strconv.Itoa(s.modules), strconv.Itoa(s.versions), s.first.Format(time.RFC3339), s.last.Format(time.RFC3339)})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i][0] < rows[j][0]
+	})
+	err := writeTable("hosting-repos", []string{"repo", "owner", "modules:int", "versions:int", "first", "last"}, rows)
+	if err != nil {
+		return err
+	}
+	err = writeMap("hosting-repomodules", multi)
+	if err != nil {
+		return err
+	}
+
+	rows = make([][]string, 0, len(a.owns))
+	for own, s := range a.owns {
+		rows = append(rows, []string{own, strconv.Itoa(len(s.repos)), strconv.Itoa(s.modules), strconv.Itoa(s.versions), s.first.Format(time.RFC3339), s.last.Format(time.RFC3339)})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i][0] < rows[j][0]
+	})
+	return writeTable("hosting-owners", []string{"owner", "repos:int", "modules:int", "versions:int", "first", "last"}, rows)
+}
+
+// owner is the host and first path element of a repo root
+func owner(repo string) string {
+	p := strings.SplitN(repo, "/", 3)
+	if len(p) < 2 {
+		return repo
+	}
+	return p[0] + "/" + p[1]
+}
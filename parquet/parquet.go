@@ -0,0 +1,301 @@
+// Package parquet writes flat Parquet files without external dependencies.
+//
+// All columns are required (no nulls or nesting), values are PLAIN encoded
+// and uncompressed. Rows are buffered into row groups of about RowGroupSize bytes,
+// which are written as they fill, so memory use does not grow with the file.
+//
+// Format reference: https://github.com/apache/parquet-format
+package parquet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// Type is the physical type of a column
+type Type int32
+
+const (
+	Bool   Type = 0
+	Int64  Type = 2
+	String Type = 6 // BYTE_ARRAY annotated as UTF8
+)
+
+// Column describes a column of the file
+type Column struct {
+	Name string
+	Type Type
+}
+
+var (
+	// RowGroupSize is the buffered size of a row group before it is written
+	RowGroupSize = 64 << 20
+	// PageSize is the size of a data page before a new one is started
+	PageSize = 1 << 20
+)
+
+const magic = "PAR1"
+
+// Writer writes rows to a Parquet file
+type Writer struct {
+	f       *os.File
+	w       *bufio.Writer
+	off     int64
+	columns []Column
+	chunks  []*chunk
+	rows    int64
+	// buffered size of the current row group
+	size   int
+	groups []rowGroup
+}
+
+// chunk is a column chunk being buffered
+type chunk struct {
+	pages [][]byte
+	page  []byte
+	// values in the current page
+	n int
+	// bits of a boolean value byte in progress
+	bits int
+	// values in the chunk
+	values int64
+}
+
+type rowGroup struct {
+	rows    int64
+	size    int64
+	columns []columnMeta
+}
+
+type columnMeta struct {
+	offset int64
+	size   int64
+	values int64
+}
+
+// Create creates or truncates the named file for writing rows with the given columns
+func Create(name string, columns ...Column) (*Writer, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("parquet create %s: %w", name, err)
+	}
+	w := &Writer{
+		f:       f,
+		w:       bufio.NewWriter(f),
+		columns: columns,
+	}
+	for range columns {
+		w.chunks = append(w.chunks, &chunk{})
+	}
+	_, err = w.w.WriteString(magic)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("parquet create %s: %w", name, err)
+	}
+	w.off = int64(len(magic))
+	return w, nil
+}
+
+// Write appends a row, values must match the column types:
+// bool for Bool, int or int64 for Int64, string for String
+func (w *Writer) Write(values ...interface{}) error {
+	if len(values) != len(w.columns) {
+		return fmt.Errorf("parquet write: %d values for %d columns", len(values), len(w.columns))
+	}
+	// check the whole row first so a bad value doesn't leave the columns uneven
+	for i, v := range values {
+		switch w.columns[i].Type {
+		case Bool:
+			if _, ok := v.(bool); !ok {
+				return fmt.Errorf("parquet write %s: %T is not a bool", w.columns[i].Name, v)
+			}
+		case Int64:
+			switch v.(type) {
+			case int, int64:
+			default:
+				return fmt.Errorf("parquet write %s: %T is not an int64", w.columns[i].Name, v)
+			}
+		case String:
+			if _, ok := v.(string); !ok {
+				return fmt.Errorf("parquet write %s: %T is not a string", w.columns[i].Name, v)
+			}
+		}
+	}
+	for i, v := range values {
+		c := w.chunks[i]
+		before := len(c.page)
+		switch w.columns[i].Type {
+		case Bool:
+			// bit packed, least significant bit first
+			if c.bits == 0 {
+				c.page = append(c.page, 0)
+			}
+			if v.(bool) {
+				c.page[len(c.page)-1] |= 1 << uint(c.bits)
+			}
+			c.bits = (c.bits + 1) % 8
+		case Int64:
+			var n int64
+			switch v := v.(type) {
+			case int:
+				n = int64(v)
+			case int64:
+				n = v
+			}
+			var buf [8]byte
+			binary.LittleEndian.PutUint64(buf[:], uint64(n))
+			c.page = append(c.page, buf[:]...)
+		case String:
+			s := v.(string)
+			var buf [4]byte
+			binary.LittleEndian.PutUint32(buf[:], uint32(len(s)))
+			c.page = append(c.page, buf[:]...)
+			c.page = append(c.page, s...)
+		}
+		c.n++
+		c.values++
+		w.size += len(c.page) - before
+		if len(c.page) >= PageSize && c.bits == 0 {
+			c.flush()
+		}
+	}
+	w.rows++
+	if w.size >= RowGroupSize {
+		return w.writeRowGroup()
+	}
+	return nil
+}
+
+// flush ends the current page of the chunk
+func (c *chunk) flush() {
+	if c.n == 0 {
+		return
+	}
+	var h thrift
+	h.i32(1, 0) // DATA_PAGE
+	h.i32(2, int32(len(c.page)))
+	h.i32(3, int32(len(c.page)))
+	h.structBegin(5) // DataPageHeader
+	h.i32(1, int32(c.n))
+	h.i32(2, 0) // PLAIN
+	h.i32(3, 3) // RLE definition levels, none for required columns
+	h.i32(4, 3) // RLE repetition levels
+	h.structEnd()
+	h.stop()
+	c.pages = append(c.pages, append(h.b, c.page...))
+	c.page, c.n, c.bits = nil, 0, 0
+}
+
+// writeRowGroup writes the buffered column chunks
+func (w *Writer) writeRowGroup() error {
+	if w.rows == 0 {
+		return nil
+	}
+	rg := rowGroup{rows: w.rows}
+	for _, c := range w.chunks {
+		c.flush()
+		cm := columnMeta{offset: w.off, values: c.values}
+		for _, p := range c.pages {
+			_, err := w.w.Write(p)
+			if err != nil {
+				return fmt.Errorf("parquet write row group: %w", err)
+			}
+			cm.size += int64(len(p))
+		}
+		w.off += cm.size
+		rg.size += cm.size
+		rg.columns = append(rg.columns, cm)
+		*c = chunk{}
+	}
+	w.groups = append(w.groups, rg)
+	w.rows, w.size = 0, 0
+	return nil
+}
+
+// Close writes any buffered rows and the file footer, then closes the file
+func (w *Writer) Close() error {
+	err := w.close()
+	cerr := w.f.Close()
+	if err != nil {
+		return err
+	} else if cerr != nil {
+		return fmt.Errorf("parquet close: %w", cerr)
+	}
+	return nil
+}
+
+func (w *Writer) close() error {
+	err := w.writeRowGroup()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, rg := range w.groups {
+		total += rg.rows
+	}
+
+	var m thrift
+	m.i32(1, 1) // version
+	m.listBegin(2, typeStruct, len(w.columns)+1)
+	// root of the schema
+	m.elemBegin()
+	m.binary(4, "schema")
+	m.i32(5, int32(len(w.columns)))
+	m.elemEnd()
+	for _, c := range w.columns {
+		m.elemBegin()
+		m.i32(1, int32(c.Type))
+		m.i32(3, 0) // REQUIRED
+		m.binary(4, c.Name)
+		if c.Type == String {
+			m.i32(6, 0) // UTF8
+		}
+		m.elemEnd()
+	}
+	m.i64(3, total)
+	m.listBegin(4, typeStruct, len(w.groups))
+	for _, rg := range w.groups {
+		m.elemBegin()
+		m.listBegin(1, typeStruct, len(rg.columns))
+		for i, cm := range rg.columns {
+			m.elemBegin()
+			m.i64(2, cm.offset)
+			m.structBegin(3) // ColumnMetaData
+			m.i32(1, int32(w.columns[i].Type))
+			m.listBegin(2, typeI32, 2)
+			m.listI32(0) // PLAIN
+			m.listI32(3) // RLE
+			m.listBegin(3, typeBinary, 1)
+			m.listBinary(w.columns[i].Name)
+			m.i32(4, 0) // UNCOMPRESSED
+			m.i64(5, cm.values)
+			m.i64(6, cm.size)
+			m.i64(7, cm.size)
+			m.i64(9, cm.offset)
+			m.structEnd()
+			m.elemEnd()
+		}
+		m.i64(2, rg.size)
+		m.i64(3, rg.rows)
+		m.elemEnd()
+	}
+	m.binary(6, "gomodstats")
+	m.stop()
+
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(len(m.b)))
+	for _, b := range [][]byte{m.b, n[:], []byte(magic)} {
+		_, err = w.w.Write(b)
+		if err != nil {
+			return fmt.Errorf("parquet write footer: %w", err)
+		}
+	}
+	err = w.w.Flush()
+	if err != nil {
+		return fmt.Errorf("parquet write footer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// tstruct is a decoded thrift struct by field id
+type tstruct map[int16]interface{}
+
+// tdecoder reads the thrift compact protocol
+type tdecoder struct {
+	t *testing.T
+	b []byte
+}
+
+func (d *tdecoder) byte() byte {
+	d.t.Helper()
+	if len(d.b) == 0 {
+		d.t.Fatal("thrift: unexpected end of input")
+	}
+	c := d.b[0]
+	d.b = d.b[1:]
+	return c
+}
+
+func (d *tdecoder) varint() uint64 {
+	d.t.Helper()
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.t.Fatal("thrift: bad varint")
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *tdecoder) zigzag() int64 {
+	v := d.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (d *tdecoder) value(typ byte) interface{} {
+	d.t.Helper()
+	switch typ {
+	case 1, 2: // bool in a field header
+		return typ == 1
+	case typeI32, typeI64:
+		return d.zigzag()
+	case typeBinary:
+		n := int(d.varint())
+		if n > len(d.b) {
+			d.t.Fatal("thrift: binary too long")
+		}
+		s := string(d.b[:n])
+		d.b = d.b[n:]
+		return s
+	case typeList:
+		h := d.byte()
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(d.varint())
+		}
+		l := make([]interface{}, n)
+		for i := range l {
+			l[i] = d.value(h & 0x0f)
+		}
+		return l
+	case typeStruct:
+		return d.strct()
+	}
+	d.t.Fatalf("thrift: unsupported type %d", typ)
+	return nil
+}
+
+func (d *tdecoder) strct() tstruct {
+	d.t.Helper()
+	s := make(tstruct)
+	var last int16
+	for {
+		h := d.byte()
+		if h == 0 {
+			return s
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			id = int16(d.zigzag())
+		}
+		s[id] = d.value(h & 0x0f)
+		last = id
+	}
+}
+
+func TestThrift(t *testing.T) {
+	var e thrift
+	e.i32(1, -3)
+	e.i64(20, 1<<40)
+	e.binary(21, "name")
+	e.structBegin(22)
+	e.i32(1, 7)
+	e.structEnd()
+	e.listBegin(23, typeI32, 2)
+	e.listI32(0)
+	e.listI32(-1)
+	e.listBegin(24, typeStruct, 16)
+	for i := 0; i < 16; i++ {
+		e.elemBegin()
+		e.i64(2, int64(i))
+		e.elemEnd()
+	}
+	e.stop()
+
+	d := tdecoder{t, e.b}
+	got := d.strct()
+	elems := make([]interface{}, 16)
+	for i := range elems {
+		elems[i] = tstruct{2: int64(i)}
+	}
+	want := tstruct{
+		1:  int64(-3),
+		20: int64(1 << 40),
+		21: "name",
+		22: tstruct{1: int64(7)},
+		23: []interface{}{int64(0), int64(-1)},
+		24: elems,
+	}
+	if !reflect.DeepEqual(got, want) || len(d.b) != 0 {
+		t.Errorf("decoded %v, %d bytes left, want %v", got, len(d.b), want)
+	}
+}
+
+// readFile reads back a file written by Writer, returning its footer
+// and the values of each column with the number of pages of each chunk
+func readFile(t *testing.T, fn string) (meta tstruct, columns [][]interface{}, pages [][]int) {
+	t.Helper()
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) < 12 || string(b[:4]) != magic || string(b[len(b)-4:]) != magic {
+		t.Fatalf("missing magic")
+	}
+	n := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	d := tdecoder{t, b[len(b)-8-n : len(b)-8]}
+	meta = d.strct()
+	if len(d.b) != 0 {
+		t.Fatalf("%d bytes after footer", len(d.b))
+	}
+
+	schema := meta[2].([]interface{})
+	types := make([]Type, len(schema)-1)
+	for i, e := range schema[1:] {
+		types[i] = Type(e.(tstruct)[1].(int64))
+	}
+	columns = make([][]interface{}, len(types))
+	for _, rg := range meta[4].([]interface{}) {
+		var ps []int
+		for i, cc := range rg.(tstruct)[1].([]interface{}) {
+			cm := cc.(tstruct)[3].(tstruct)
+			off, size := cm[9].(int64), cm[7].(int64)
+			d := tdecoder{t, b[off : off+size]}
+			var values int64
+			var np int
+			for len(d.b) > 0 {
+				h := d.strct()
+				if h[1].(int64) != 0 || h[2] != h[3] {
+					t.Fatalf("page header %v", h)
+				}
+				data := d.b[:h[3].(int64)]
+				d.b = d.b[len(data):]
+				nv := int(h[5].(tstruct)[1].(int64))
+				columns[i] = append(columns[i], decodePlain(t, types[i], data, nv)...)
+				values += int64(nv)
+				np++
+			}
+			if values != cm[5].(int64) {
+				t.Errorf("column chunk has %d values, metadata says %d", values, cm[5])
+			}
+			ps = append(ps, np)
+		}
+		pages = append(pages, ps)
+	}
+	return meta, columns, pages
+}
+
+func decodePlain(t *testing.T, typ Type, b []byte, n int) []interface{} {
+	t.Helper()
+	vs := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		switch typ {
+		case Bool:
+			vs = append(vs, b[i/8]>>(i%8)&1 == 1)
+		case Int64:
+			vs = append(vs, int64(binary.LittleEndian.Uint64(b)))
+			b = b[8:]
+		case String:
+			l := binary.LittleEndian.Uint32(b)
+			vs = append(vs, string(b[4:4+l]))
+			b = b[4+l:]
+		}
+	}
+	if typ == Bool {
+		b = b[(n+7)/8:]
+	}
+	if len(b) != 0 {
+		t.Fatalf("%d bytes left in page", len(b))
+	}
+	return vs
+}
+
+func TestRoundTrip(t *testing.T) {
+	defer func(rg, p int) { RowGroupSize, PageSize = rg, p }(RowGroupSize, PageSize)
+	cols := []Column{{"name", String}, {"n", Int64}, {"ok", Bool}}
+
+	for _, tt := range []struct {
+		name               string
+		rowGroupSize, page int
+		rows               int
+		groups             int
+	}{
+		{"empty", RowGroupSize, PageSize, 0, 0},
+		{"one page", RowGroupSize, PageSize, 100, 1},
+		// about 200 rows per group, bool pages of 64 values
+		// and the last byte of a chunk partly filled
+		{"many pages", 4000, 8, 1003, 5},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			RowGroupSize, PageSize = tt.rowGroupSize, tt.page
+			fn := filepath.Join(t.TempDir(), "test.parquet")
+			w, err := Create(fn, cols...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := make([][]interface{}, len(cols))
+			for i := 0; i < tt.rows; i++ {
+				row := []interface{}{fmt.Sprintf("row-%d", i), int64(i * i), i%3 == 0}
+				err = w.Write(row...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for j, v := range row {
+					want[j] = append(want[j], v)
+				}
+			}
+			err = w.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			meta, got, pages := readFile(t, fn)
+			if meta[3].(int64) != int64(tt.rows) {
+				t.Errorf("num_rows = %v, want %d", meta[3], tt.rows)
+			}
+			schema := meta[2].([]interface{})
+			if len(schema) != len(cols)+1 || schema[0].(tstruct)[5].(int64) != int64(len(cols)) {
+				t.Fatalf("schema = %v", schema)
+			}
+			for i, c := range cols {
+				e := schema[i+1].(tstruct)
+				if e[4] != c.Name || e[3].(int64) != 0 || (e[6] != nil) != (c.Type == String) {
+					t.Errorf("schema element %d = %v, want required %s", i+1, e, c.Name)
+				}
+			}
+			if len(pages) != tt.groups {
+				t.Errorf("%d row groups, want %d", len(pages), tt.groups)
+			}
+			var rows int64
+			for _, rg := range meta[4].([]interface{}) {
+				rows += rg.(tstruct)[3].(int64)
+			}
+			if rows != int64(tt.rows) {
+				t.Errorf("row groups have %d rows, want %d", rows, tt.rows)
+			}
+			for i := range cols {
+				if len(got[i]) != len(want[i]) || (len(want[i]) > 0 && !reflect.DeepEqual(got[i], want[i])) {
+					t.Errorf("column %s = %.60v, want %.60v", cols[i].Name, got[i], want[i])
+				}
+			}
+			if tt.page == 8 {
+				for g, ps := range pages {
+					// every value of a string or int64 column fills a page
+					if ps[0] < 100 || ps[1] < 100 || ps[2] < 2 {
+						t.Errorf("row group %d has pages %v, want several per column", g, ps)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.parquet")
+	w, err := Create(fn, Column{"n", Int64}, Column{"ok", Bool}, Column{"s", String})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][]interface{}{
+		{int64(1), true},
+		{"1", true, ""},
+		{1, 1, ""},
+		{1, true, []byte("")},
+	} {
+		if err := w.Write(row...); err == nil {
+			t.Errorf("Write(%v) = nil, want error", row)
+		}
+	}
+	err = w.Write(1, true, "s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rejected rows leave nothing behind
+	_, got, _ := readFile(t, fn)
+	want := [][]interface{}{{int64(1)}, {true}, {"s"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read %v, want %v", got, want)
+	}
+}
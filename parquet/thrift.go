@@ -0,0 +1,105 @@
+package parquet
+
+// thrift compact protocol types
+const (
+	typeI32    = 5
+	typeI64    = 6
+	typeBinary = 8
+	typeList   = 9
+	typeStruct = 12
+)
+
+// thrift encodes structs with the thrift compact protocol,
+// which parquet uses for page headers and file metadata
+type thrift struct {
+	b []byte
+	// last field id of the current struct, and of the enclosing structs
+	last  int16
+	stack []int16
+}
+
+func (t *thrift) field(id int16, typ byte) {
+	if d := id - t.last; d > 0 && d <= 15 {
+		t.b = append(t.b, byte(d)<<4|typ)
+	} else {
+		t.b = append(t.b, typ)
+		t.varint(zigzag(int64(id)))
+	}
+	t.last = id
+}
+
+func (t *thrift) i32(id int16, v int32) {
+	t.field(id, typeI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, typeI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thrift) binary(id int16, s string) {
+	t.field(id, typeBinary)
+	t.varint(uint64(len(s)))
+	t.b = append(t.b, s...)
+}
+
+// structBegin starts a struct field, end it with structEnd
+func (t *thrift) structBegin(id int16) {
+	t.field(id, typeStruct)
+	t.elemBegin()
+}
+
+func (t *thrift) structEnd() {
+	t.elemEnd()
+}
+
+// listBegin starts a list field of n elements,
+// followed by n listI32, listBinary or elemBegin / elemEnd struct elements
+func (t *thrift) listBegin(id int16, typ byte, n int) {
+	t.field(id, typeList)
+	if n < 15 {
+		t.b = append(t.b, byte(n)<<4|typ)
+	} else {
+		t.b = append(t.b, 0xf0|typ)
+		t.varint(uint64(n))
+	}
+}
+
+func (t *thrift) listI32(v int32) {
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thrift) listBinary(s string) {
+	t.varint(uint64(len(s)))
+	t.b = append(t.b, s...)
+}
+
+// elemBegin starts a struct without a field header, as in a list
+func (t *thrift) elemBegin() {
+	t.stack = append(t.stack, t.last)
+	t.last = 0
+}
+
+func (t *thrift) elemEnd() {
+	t.stop()
+	t.last = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+// stop ends the top level struct
+func (t *thrift) stop() {
+	t.b = append(t.b, 0)
+}
+
+func (t *thrift) varint(v uint64) {
+	for v >= 0x80 {
+		t.b = append(t.b, byte(v)|0x80)
+		v >>= 7
+	}
+	t.b = append(t.b, byte(v))
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.seankhliao.com/gomodstats/v2/pb"
+	"golang.org/x/mod/semver"
+)
+
+// queryAggregator filters selected module versions with a Go syntax boolean expression
+// and writes projected columns of matching rows to out.
+//
+// Expressions can use:
+// string fields: path (or module), version, timestamp, go, host, major, kind;
+// int fields: requires, replaces, excludes, idents, tokens (totals);
+// lookups: ident["x"], token["x"] (counts, 0 if absent),
+// require["module"] (required version, "" if absent);
+// int and string literals, true, false,
+// ! && || == != < <= > >= and + - * / on ints.
+// Strings compare as in report keys: integers numerically,
+// versions, ex "1.13" or "v1.2.3", by semver.
+// Ordering strings of different kinds is false,
+// ex go >= "1.13" for a module without a go directive
+type queryAggregator struct {
+	filter ast.Expr
+	fields []ast.Expr
+	names  []string
+	format string
+	out    io.Writer
+	rows   [][]interface{}
+}
+
+func newQueryAggregator(filter, fields, format string, out io.Writer) (*queryAggregator, error) {
+	f, err := parser.ParseExpr(querySource(filter))
+	if err != nil {
+		return nil, fmt.Errorf("newQueryAggregator parse filter: %w", err)
+	}
+	err = checkQuery(f)
+	if err != nil {
+		return nil, fmt.Errorf("newQueryAggregator filter: %w", err)
+	}
+
+	fs, names, err := parseQueryList(fields)
+	if err != nil {
+		return nil, fmt.Errorf("newQueryAggregator fields: %w", err)
+	}
+	q := &queryAggregator{
+		filter: f,
+		fields: fs,
+		names:  names,
+		format: format,
+		out:    out,
+	}
+	if strings.Contains(format, ",") {
+		return nil, fmt.Errorf("newQueryAggregator: only one format can be written to stdout, got %s", format)
+	}
+	return q, nil
+}
+
+// parseQueryList parses comma separated query expressions,
+// returning them with their source text
+func parseQueryList(list string) ([]ast.Expr, []string, error) {
+	// parse as arguments to a call to get a list of expressions
+	src := "f(" + list + ")"
+	fset := token.NewFileSet()
+	x, err := parser.ParseExprFrom(fset, "", querySource(src), 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parseQueryList: %w", err)
+	}
+	// ex "a)(b" parses as f(a)(b)
+	call, ok := x.(*ast.CallExpr)
+	if ok {
+		f, isIdent := call.Fun.(*ast.Ident)
+		ok = isIdent && f.Name == "f"
+	}
+	if !ok {
+		return nil, nil, fmt.Errorf("parseQueryList: not a list of expressions")
+	}
+	var names []string
+	for _, fx := range call.Args {
+		err = checkQuery(fx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parseQueryList: %w", err)
+		}
+		names = append(names, src[fset.Position(fx.Pos()).Offset:fset.Position(fx.End()).Offset])
+	}
+	return call.Args, names, nil
+}
+
+func (q *queryAggregator) Name() string { return "query" }
+
+func (q *queryAggregator) Selected(ir *pb.IndexRecord, mv *pb.ModuleVersion) error {
+	env := queryEnv{ir, mv}
+	match, err := env.eval(q.filter)
+	if err != nil {
+		log.Println("query", ir.Path, ir.Version, err)
+		return nil
+	} else if b, ok := match.(bool); !ok {
+		log.Println("query", ir.Path, ir.Version, "filter is not a boolean:", match)
+		return nil
+	} else if !b {
+		return nil
+	}
+	row := make([]interface{}, 0, len(q.fields))
+	for _, f := range q.fields {
+		v, err := env.eval(f)
+		if err != nil {
+			log.Println("query", ir.Path, ir.Version, err)
+			return nil
+		}
+		row = append(row, v)
+	}
+	q.rows = append(q.rows, row)
+	return nil
+}
+
+func (q *queryAggregator) Write() error {
+	t := table{name: "query"}
+	for i, n := range q.names {
+		typ := ""
+		if len(q.rows) > 0 {
+			switch q.rows[0][i].(type) {
+			case int64:
+				typ = ":int"
+			case bool:
+				typ = ":bool"
+			}
+		}
+		t.header = append(t.header, n+typ)
+	}
+	for _, row := range q.rows {
+		r := make([]string, len(row))
+		for i, v := range row {
+			r[i] = fmt.Sprint(v)
+		}
+		t.rows = append(t.rows, r)
+	}
+	return t.write(q.out, q.format)
+}
+
+// querySource makes the go keyword usable as a field name,
+// it is replaced by Go which keeps offsets into the source unchanged
+func querySource(src string) string {
+	b := []byte(src)
+	fset := token.NewFileSet()
+	var s scanner.Scanner
+	s.Init(fset.AddFile("", fset.Base(), len(b)), b, nil, 0)
+	for {
+		pos, tok, _ := s.Scan()
+		if tok == token.EOF {
+			break
+		} else if tok == token.GO {
+			b[fset.Position(pos).Offset] = 'G'
+		}
+	}
+	return string(b)
+}
+
+var (
+	queryFields = map[string]bool{
+		"path": true, "module": true, "version": true, "timestamp": true,
+		"Go": true, "host": true, "major": true, "kind": true,
+		"requires": true, "replaces": true, "excludes": true, "idents": true, "tokens": true,
+		"true": true, "false": true,
+	}
+	queryLookups = map[string]bool{
+		"ident": true, "token": true, "require": true,
+	}
+)
+
+// checkQuery rejects expressions the evaluator does not support
+func checkQuery(x ast.Expr) error {
+	var err error
+	ast.Inspect(x, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		switch n := n.(type) {
+		case nil, *ast.ParenExpr, *ast.UnaryExpr, *ast.BinaryExpr:
+		case *ast.BasicLit:
+			if n.Kind != token.INT && n.Kind != token.STRING {
+				err = fmt.Errorf("unsupported literal %s", n.Value)
+			}
+		case *ast.Ident:
+			if !queryFields[n.Name] {
+				err = fmt.Errorf("unknown field %s", n.Name)
+			}
+		case *ast.IndexExpr:
+			id, ok := n.X.(*ast.Ident)
+			if !ok || !queryLookups[id.Name] {
+				err = fmt.Errorf("only ident, token and require can be indexed")
+				return false
+			}
+			ast.Inspect(n.Index, func(n ast.Node) bool {
+				if err == nil {
+					if x, ok := n.(ast.Expr); ok {
+						err = checkQuery(x)
+					}
+				}
+				return false
+			})
+			return false
+		default:
+			err = fmt.Errorf("unsupported expression %T", n)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// queryEnv evaluates query expressions against one module version
+type queryEnv struct {
+	ir *pb.IndexRecord
+	mv *pb.ModuleVersion
+}
+
+func (e queryEnv) eval(x ast.Expr) (interface{}, error) {
+	switch x := x.(type) {
+	case *ast.ParenExpr:
+		return e.eval(x.X)
+	case *ast.BasicLit:
+		if x.Kind == token.INT {
+			return strconv.ParseInt(x.Value, 0, 64)
+		}
+		return strconv.Unquote(x.Value)
+	case *ast.Ident:
+		return e.field(x.Name), nil
+	case *ast.IndexExpr:
+		k, err := e.eval(x.Index)
+		if err != nil {
+			return nil, err
+		}
+		ks, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("index %v is not a string", k)
+		}
+		switch x.X.(*ast.Ident).Name {
+		case "ident":
+			return e.mv.Idents[ks], nil
+		case "token":
+			return e.mv.Tokens[ks], nil
+		}
+		for _, r := range e.mv.Requires {
+			if r.Version.Module == ks {
+				return r.Version.Version, nil
+			}
+		}
+		return "", nil
+	case *ast.UnaryExpr:
+		v, err := e.eval(x.X)
+		if err != nil {
+			return nil, err
+		}
+		switch v := v.(type) {
+		case bool:
+			if x.Op == token.NOT {
+				return !v, nil
+			}
+		case int64:
+			if x.Op == token.SUB {
+				return -v, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid operation %s%v", x.Op, v)
+	case *ast.BinaryExpr:
+		return e.binary(x)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", x)
+}
+
+func (e queryEnv) field(name string) interface{} {
+	switch name {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "path", "module":
+		return e.ir.Path
+	case "version":
+		return e.ir.Version
+	case "timestamp":
+		return e.ir.Timestamp
+	case "Go":
+		return e.mv.Go
+	case "host":
+		return strings.SplitN(e.ir.Path, "/", 2)[0]
+	case "major":
+		return semver.Major(e.ir.Version)
+	case "kind":
+		return versionKind(e.ir.Version)
+	case "requires":
+		return int64(len(e.mv.Requires))
+	case "replaces":
+		return int64(len(e.mv.Replaces))
+	case "excludes":
+		return int64(len(e.mv.Excludes))
+	case "idents":
+		var n int64
+		for _, c := range e.mv.Idents {
+			n += c
+		}
+		return n
+	case "tokens":
+		var n int64
+		for _, c := range e.mv.Tokens {
+			n += c
+		}
+		return n
+	}
+	return nil
+}
+
+func (e queryEnv) binary(x *ast.BinaryExpr) (interface{}, error) {
+	l, err := e.eval(x.X)
+	if err != nil {
+		return nil, err
+	}
+	if x.Op == token.LAND || x.Op == token.LOR {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("invalid operation %v %s", l, x.Op)
+		}
+		if lb == (x.Op == token.LOR) {
+			return lb, nil
+		}
+		r, err := e.eval(x.Y)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("invalid operation %s %v", x.Op, r)
+		}
+		return rb, nil
+	}
+
+	r, err := e.eval(x.Y)
+	if err != nil {
+		return nil, err
+	}
+	var c int
+	switch l := l.(type) {
+	case int64:
+		ri, ok := r.(int64)
+		if !ok {
+			return nil, fmt.Errorf("mismatched types %v %s %v", l, x.Op, r)
+		}
+		switch x.Op {
+		case token.ADD:
+			return l + ri, nil
+		case token.SUB:
+			return l - ri, nil
+		case token.MUL:
+			return l * ri, nil
+		case token.QUO:
+			if ri == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return l / ri, nil
+		}
+		switch {
+		case l < ri:
+			c = -1
+		case l > ri:
+			c = 1
+		}
+	case string:
+		rs, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("mismatched types %q %s %v", l, x.Op, r)
+		}
+		if keyClass(l).class != keyClass(rs).class && x.Op != token.EQL && x.Op != token.NEQ {
+			return false, nil
+		}
+		c = compareKeys(l, rs)
+	case bool:
+		rb, ok := r.(bool)
+		if !ok || (x.Op != token.EQL && x.Op != token.NEQ) {
+			return nil, fmt.Errorf("invalid operation %v %s %v", l, x.Op, r)
+		}
+		return (l == rb) == (x.Op == token.EQL), nil
+	default:
+		return nil, fmt.Errorf("invalid operation %v %s %v", l, x.Op, r)
+	}
+
+	switch x.Op {
+	case token.EQL:
+		return c == 0, nil
+	case token.NEQ:
+		return c != 0, nil
+	case token.LSS:
+		return c < 0, nil
+	case token.LEQ:
+		return c <= 0, nil
+	case token.GTR:
+		return c > 0, nil
+	case token.GEQ:
+		return c >= 0, nil
+	}
+	return nil, fmt.Errorf("invalid operation %v %s %v", l, x.Op, r)
+}
+
+// query writes the selected module versions matching filter to stdout
+func query(filter, fields, format, policy string) {
+	q, err := newQueryAggregator(filter, fields, format, os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pbi, err := Index(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = aggregate(asOf(pbi, asof.Time), []Aggregator{q}, policy)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
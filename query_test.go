@@ -0,0 +1,204 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.seankhliao.com/gomodstats/v2/pb"
+)
+
+func TestQuerySource(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{`go >= "1.13"`, `Go >= "1.13"`},
+		{`path == "go" && go != ""`, `path == "go" && Go != ""`},
+		{`ident["go"]`, `ident["go"]`},
+		{`version`, `version`},
+	}
+	for _, tt := range tests {
+		if got := querySource(tt.src); got != tt.want {
+			t.Errorf("querySource(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestCheckQuery(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{`go >= "1.13" && ident["x"] > 0`, ""},
+		{`!(requires > 1) || require["golang.org/x/mod"] != ""`, ""},
+		{`-tokens + 0x10 * 2 / 1`, ""},
+		{`true == false`, ""},
+		{`token[path]`, ""},
+		{`foo`, "unknown field foo"},
+		{`ident[foo]`, "unknown field foo"},
+		{`1.5 > 1`, "unsupported literal 1.5"},
+		{`'a' == path`, "unsupported literal 'a'"},
+		{`len(path)`, "unsupported expression *ast.CallExpr"},
+		{`path.x`, "unsupported expression *ast.SelectorExpr"},
+		{`path[0]`, "only ident, token and require can be indexed"},
+		{`path[1:]`, "unsupported expression *ast.SliceExpr"},
+	}
+	for _, tt := range tests {
+		x, err := parser.ParseExpr(querySource(tt.src))
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.src, err)
+		}
+		err = checkQuery(x)
+		if tt.err == "" && err != nil {
+			t.Errorf("checkQuery(%q) = %v, want nil", tt.src, err)
+		} else if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("checkQuery(%q) = %v, want %s", tt.src, err, tt.err)
+		}
+	}
+}
+
+func TestParseQueryList(t *testing.T) {
+	tests := []struct {
+		list  string
+		names []string
+		err   bool
+	}{
+		{"path,version", []string{"path", "version"}, false},
+		{`go, ident["err"] + 1`, []string{"go", `ident["err"] + 1`}, false},
+		{`require["a,b"], kind`, []string{`require["a,b"]`, "kind"}, false},
+		{"", nil, false},
+		{"path,foo", nil, true},
+		{"path)(", nil, true},
+	}
+	for _, tt := range tests {
+		xs, names, err := parseQueryList(tt.list)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseQueryList(%q) = %v, want error", tt.list, names)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseQueryList(%q) = %v", tt.list, err)
+			continue
+		}
+		if len(xs) != len(names) || !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("parseQueryList(%q) = %d exprs %q, want %q", tt.list, len(xs), names, tt.names)
+		}
+	}
+}
+
+func TestQueryEval(t *testing.T) {
+	env := queryEnv{
+		ir: &pb.IndexRecord{Path: "github.com/a/b/v2", Version: "v2.1.0", Timestamp: "2020-05-01T00:00:00Z"},
+		mv: &pb.ModuleVersion{
+			Go: "1.14",
+			Requires: []*pb.Require{
+				{Version: &pb.Version{Module: "github.com/x/y", Version: "v1.2.3"}},
+			},
+			Replaces: []*pb.Replace{{}},
+			Idents:   map[string]int64{"err": 11, "x": 2},
+			Tokens:   map[string]int64{"IDENT": 13, "(": 4},
+		},
+	}
+	tests := []struct {
+		src  string
+		want interface{}
+		err  string
+	}{
+		// fields
+		{`path`, "github.com/a/b/v2", ""},
+		{`module`, "github.com/a/b/v2", ""},
+		{`host`, "github.com", ""},
+		{`major`, "v2", ""},
+		{`kind`, "release", ""},
+		{`go`, "1.14", ""},
+		{`requires`, int64(1), ""},
+		{`replaces`, int64(1), ""},
+		{`excludes`, int64(0), ""},
+		{`idents`, int64(13), ""},
+		{`tokens`, int64(17), ""},
+
+		// lookups
+		{`ident["err"]`, int64(11), ""},
+		{`ident["none"]`, int64(0), ""},
+		{`token["("]`, int64(4), ""},
+		{`require["github.com/x/y"]`, "v1.2.3", ""},
+		{`require["none"]`, "", ""},
+		{`ident[1]`, nil, "index 1 is not a string"},
+
+		// arithmetic
+		{`(1 + 2) * 3 - 4 / 2`, int64(7), ""},
+		{`0x10 == 16`, true, ""},
+		{`-ident["x"]`, int64(-2), ""},
+		{`1 / 0`, nil, "division by zero"},
+		{`1 + "a"`, nil, `mismatched types 1 + a`},
+		{`"a" + "b"`, nil, "invalid operation a + b"},
+
+		// comparisons
+		{`go >= "1.13"`, true, ""},
+		{`go < "1.9"`, false, ""},
+		{`version > "v2.0.10"`, true, ""},
+		{`path != "x"`, true, ""},
+		{`requires <= 1`, true, ""},
+		{`true == false`, false, ""},
+		{`true != false`, true, ""},
+		{`true < false`, nil, "invalid operation true < false"},
+		{`"a" == 1`, nil, `mismatched types "a" == 1`},
+
+		// logic
+		{`!false`, true, ""},
+		{`!1`, nil, "invalid operation !1"},
+		{`ident["err"] > 10 && token["("] == 4`, true, ""},
+		{`false && 1 / 0 == 0`, false, ""},
+		{`true || 1 / 0 == 0`, true, ""},
+		{`true && 1 / 0 == 0`, nil, "division by zero"},
+		{`1 && true`, nil, "invalid operation 1 &&"},
+		{`true && 1`, nil, "invalid operation && 1"},
+	}
+	for _, tt := range tests {
+		got, err := env.eval(parseQuery(t, tt.src))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("eval(%q) = %v, %v, want error %s", tt.src, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("eval(%q) = %#v, %v, want %#v", tt.src, got, err, tt.want)
+		}
+	}
+
+	// no go directive
+	env.mv.Go = ""
+	for _, tt := range []struct {
+		src  string
+		want bool
+	}{
+		{`go >= "1.13"`, false},
+		{`go < "1.13"`, false},
+		{`go == ""`, true},
+		{`go != "1.13"`, true},
+		{`go < "a"`, false},
+		{`"" <= go`, true},
+	} {
+		got, err := env.eval(parseQuery(t, tt.src))
+		if err != nil || got != tt.want {
+			t.Errorf("eval(%q) with empty go = %#v, %v, want %v", tt.src, got, err, tt.want)
+		}
+	}
+}
+
+func parseQuery(t *testing.T, src string) ast.Expr {
+	t.Helper()
+	x, err := parser.ParseExpr(querySource(src))
+	if err != nil {
+		t.Fatalf("parse %q: %v", src, err)
+	}
+	if err := checkQuery(x); err != nil {
+		t.Fatalf("checkQuery(%q) = %v", src, err)
+	}
+	return x
+}
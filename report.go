@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reportRows is the most rows shown on a report page, the csv has all of them
+const reportRows = 500
+
+var reportTemplates = template.Must(template.New("index").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>gomodstats {{ .Date }}</title>
+{{ template "style" }}
+</head>
+<body>
+<h1>gomodstats</h1>
+<p>Go module ecosystem report, generated {{ .Date }}{{ with .AsOf }}, index records up to {{ . }}{{ end }}.</p>
+{{ range .Groups }}
+<h2>{{ .Name }}</h2>
+<ul>
+{{ range .Pages }}<li><a href="{{ .Name }}.html">{{ .Name }}</a> <span class="n">{{ .Rows }} rows</span></li>
+{{ end }}</ul>
+{{ end }}
+</body>
+</html>
+`))
+
+func init() {
+	template.Must(reportTemplates.New("style").Parse(`<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 960px; padding: 0 1em; color: #222; }
+a { color: #4e79a7; }
+.n { color: #777; font-size: smaller; }
+table { border-collapse: collapse; font-size: 13px; }
+th, td { border-bottom: 1px solid #ddd; padding: 2px 8px; text-align: left; }
+td.num, th.num { text-align: right; font-variant-numeric: tabular-nums; }
+svg { max-width: 100%; height: auto; }
+</style>`))
+	template.Must(reportTemplates.New("page").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{ .Name }} - gomodstats</title>
+{{ template "style" }}
+</head>
+<body>
+<p><a href="index.html">gomodstats</a> / {{ .Name }}</p>
+<h1>{{ .Name }}</h1>
+{{ with .Chart }}<figure>{{ . }}</figure>{{ end }}
+<p class="n">{{ .Rows }} rows{{ if .Truncated }}, showing the first {{ len .Table }}{{ end }}, full data in <a href="{{ .Name }}.csv">{{ .Name }}.csv</a></p>
+<table>
+<thead><tr>{{ range $i, $h := .Header }}<th{{ if index $.Numeric $i }} class="num"{{ end }}>{{ $h }}</th>{{ end }}</tr></thead>
+<tbody>
+{{ range .Table }}<tr>{{ range $i, $c := . }}<td{{ if index $.Numeric $i }} class="num"{{ end }}>{{ $c }}</td>{{ end }}</tr>
+{{ end }}</tbody>
+</table>
+</body>
+</html>
+`))
+}
+
+type reportPage struct {
+	Name      string
+	Header    []string
+	Numeric   []bool
+	Table     [][]string
+	Rows      int
+	Truncated bool
+	Chart     template.HTML
+}
+
+type reportGroup struct {
+	Name  string
+	Pages []reportPage
+}
+
+// reportHTML runs the -reports aggregators, all of them unless -reports is set,
+// and writes their tables to dir
+// as a static site: an index, a page per table with its chart inlined as svg,
+// and the full table as csv
+func reportHTML(dir, policy string) {
+	names := "all"
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "reports" {
+			names = *reports
+		}
+	})
+	aggs, err := aggregators(names)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pbi, err := Index(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var tables []table
+	tableSink = func(t table) {
+		tables = append(tables, t)
+	}
+	err = aggregate(asOf(pbi, asof.Time), aggs, policy)
+	tableSink = nil
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.SliceStable(tables, func(i, j int) bool {
+		return tables[i].name < tables[j].name
+	})
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var groups []reportGroup
+	for _, t := range tables {
+		t.headless = false
+		err = writeFile(filepath.Join(dir, t.name+".csv"), func(w io.Writer) error {
+			return t.write(w, "csv")
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		p := newReportPage(t)
+		err = writeFile(filepath.Join(dir, t.name+".html"), func(w io.Writer) error {
+			return reportTemplates.ExecuteTemplate(w, "page", p)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		g := strings.SplitN(t.name, "-", 2)[0]
+		if len(groups) == 0 || groups[len(groups)-1].Name != g {
+			groups = append(groups, reportGroup{Name: g})
+		}
+		groups[len(groups)-1].Pages = append(groups[len(groups)-1].Pages, p)
+	}
+
+	err = writeFile(filepath.Join(dir, "index.html"), func(w io.Writer) error {
+		return reportTemplates.ExecuteTemplate(w, "index", map[string]interface{}{
+			"Date":   time.Now().UTC().Format("2006-01-02"),
+			"AsOf":   asof.String(),
+			"Groups": groups,
+		})
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("report html: wrote %d reports to %s", len(tables), dir)
+}
+
+func newReportPage(t table) reportPage {
+	names, types := t.columns()
+	p := reportPage{
+		Name:    t.name,
+		Header:  names,
+		Table:   t.rows,
+		Rows:    len(t.rows),
+		Chart:   template.HTML(tableChart(t)),
+		Numeric: make([]bool, len(types)),
+	}
+	for i, typ := range types {
+		p.Numeric[i] = typ == "int" || typ == "float"
+	}
+	if len(p.Table) > reportRows {
+		p.Table, p.Truncated = p.Table[:reportRows], true
+	}
+	return p
+}
+
+// writeFile creates fn and writes it through a buffer
+func writeFile(fn string, write func(io.Writer) error) error {
+	f, err := os.Create(fn)
+	if err != nil {
+		return fmt.Errorf("writeFile create: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("writeFile %s: %w", fn, err)
+	}
+	return nil
+}
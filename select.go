@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"go.seankhliao.com/gomodstats/v2/pb"
+)
+
+// selectVersions picks the versions of a module that reports look at,
+// irs are in semver order. Policies are:
+// all, max (highest semver, any kind), latest-release,
+// latest-prerelease (highest that is not a pseudo-version)
+// and first (earliest published).
+// Modules with nothing matching the policy have no versions selected
+func selectVersions(irs []*pb.IndexRecord, policy string) ([]*pb.IndexRecord, error) {
+	switch policy {
+	case "all", "max", "latest-release", "latest-prerelease", "first":
+	default:
+		return nil, fmt.Errorf("selectVersions: unknown policy %q", policy)
+	}
+	if len(irs) == 0 {
+		return nil, nil
+	}
+
+	switch policy {
+	case "all":
+		return irs, nil
+	case "latest-release", "latest-prerelease":
+		for i := len(irs) - 1; i >= 0; i-- {
+			switch versionKind(irs[i].Version) {
+			case "release":
+				return irs[i : i+1], nil
+			case "prerelease":
+				if policy == "latest-prerelease" {
+					return irs[i : i+1], nil
+				}
+			}
+		}
+		return nil, nil
+	case "first":
+		first := irs[0]
+		ft := publishTime(first)
+		for _, ir := range irs[1:] {
+			if t := publishTime(ir); t.Before(ft) {
+				first, ft = ir, t
+			}
+		}
+		return []*pb.IndexRecord{first}, nil
+	}
+	// max
+	return irs[len(irs)-1:], nil
+}
+
+// asOf keeps the index records published by the end of the given day (UTC),
+// a zero day keeps everything
+func asOf(pbi *pb.Index, day time.Time) *pb.Index {
+	if day.IsZero() {
+		return pbi
+	}
+	end := day.AddDate(0, 0, 1)
+	var out pb.Index
+	for _, ir := range pbi.Records {
+		if publishTime(ir).Before(end) {
+			out.Records = append(out.Records, ir)
+		}
+	}
+	return &out
+}
+
+// goneAsOf keeps the gone records observed by the end of the given day (UTC),
+// a zero day keeps everything
+func goneAsOf(pbg *pb.Gone, day time.Time) *pb.Gone {
+	if day.IsZero() {
+		return pbg
+	}
+	end := day.AddDate(0, 0, 1)
+	var out pb.Gone
+	for _, gr := range pbg.Records {
+		t, err := time.Parse(time.RFC3339, gr.Observed)
+		if err != nil {
+			log.Println(err)
+		}
+		if t.Before(end) {
+			out.Records = append(out.Records, gr)
+		}
+	}
+	return &out
+}
+
+// publishTime is the index timestamp of a record,
+// unparseable timestamps are logged and sort first
+func publishTime(ir *pb.IndexRecord) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, ir.Timestamp)
+	if err != nil {
+		log.Println(err)
+	}
+	return t
+}
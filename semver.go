@@ -0,0 +1,188 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.seankhliao.com/gomodstats/v2/pb"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// hygieneAggregator reports on release practice per module:
+// majors in use, skipped and out of order releases,
+// +incompatible and v2+ versions without a matching /vN path suffix
+type hygieneAggregator struct {
+	majors map[string]int64
+	labels map[string]int64
+	rows   [][]string
+	suffix [][]string
+}
+
+func newHygieneAggregator() *hygieneAggregator {
+	return &hygieneAggregator{
+		majors: make(map[string]int64),
+		labels: make(map[string]int64),
+	}
+}
+
+func (a *hygieneAggregator) Name() string { return "hygiene" }
+
+func (a *hygieneAggregator) Module(m string, irs []*pb.IndexRecord) error {
+	_, pathMajor, _ := module.SplitPathVersion(m)
+
+	var releases []*pb.IndexRecord
+	var prereleases, pseudo, incompatible int
+	for _, ir := range irs {
+		switch versionKind(ir.Version) {
+		case "release":
+			releases = append(releases, ir)
+		case "prerelease":
+			prereleases++
+			a.labels[prereleaseLabel(ir.Version)]++
+		default:
+			pseudo++
+		}
+		// the proxy serves v2+ on a path without /vN only as +incompatible,
+		// CheckPathMajor accepts those so it only catches malformed index entries
+		if semver.Build(ir.Version) == "+incompatible" {
+			incompatible++
+			a.suffix = append(a.suffix, []string{m, ir.Version})
+		} else if err := module.CheckPathMajor(ir.Version, pathMajor); err != nil {
+			a.suffix = append(a.suffix, []string{m, ir.Version})
+		}
+	}
+
+	maxmajor := "none"
+	if len(releases) > 0 {
+		// irs are in semver order
+		maxmajor = semver.Major(releases[len(releases)-1].Version)
+	}
+	a.majors[maxmajor]++
+
+	var jumps, skipped int
+	for i := 1; i < len(releases); i++ {
+		j, s := releaseGap(releases[i-1].Version, releases[i].Version)
+		jumps += j
+		skipped += s
+	}
+
+	a.rows = append(a.rows, []string{
+		m,
+		strconv.Itoa(len(irs)),
+		strconv.Itoa(len(releases)),
+		strconv.Itoa(prereleases),
+		strconv.Itoa(pseudo),
+		maxmajor,
+		strconv.Itoa(incompatible),
+		strconv.Itoa(jumps),
+		strconv.Itoa(skipped),
+		strconv.Itoa(outOfOrder(releases)),
+	})
+	return nil
+}
+
+func (a *hygieneAggregator) Write() error {
+	sort.Slice(a.rows, func(i, j int) bool {
+		return a.rows[i][0] < a.rows[j][0]
+	})
+	sort.Slice(a.suffix, func(i, j int) bool {
+		if a.suffix[i][0] != a.suffix[j][0] {
+			return a.suffix[i][0] < a.suffix[j][0]
+		}
+		return semver.Compare(a.suffix[i][1], a.suffix[j][1]) < 0
+	})
+
+	err := writeMap("semver-majors", a.majors)
+	if err != nil {
+		return err
+	}
+	err = writeMap("semver-prerelabels", a.labels)
+	if err != nil {
+		return err
+	}
+	err = writeTable("semver-modules", []string{"module", "versions:int", "releases:int", "prereleases:int", "pseudo:int", "maxmajor", "incompatible:int", "majorjumps:int", "skipped:int", "outoforder:int"}, a.rows)
+	if err != nil {
+		return err
+	}
+	return writeTable("semver-missingsuffix", []string{"module", "version"}, a.suffix)
+}
+
+// prereleaseLabel is the first prerelease identifier with trailing digits
+// and separators removed, ex rc for v1.0.0-rc.1 and beta for v1.0.0-beta2
+func prereleaseLabel(v string) string {
+	l := strings.TrimPrefix(semver.Prerelease(v), "-")
+	l = strings.SplitN(l, ".", 2)[0]
+	l = strings.TrimRight(l, "0123456789-_")
+	if l == "" {
+		return "numeric"
+	}
+	return strings.ToLower(l)
+}
+
+// releaseGap compares consecutive releases a < b,
+// returning the number of skipped majors and whether a minor or patch was skipped
+func releaseGap(a, b string) (jumps, skipped int) {
+	amaj, amin, apat := semverParts(a)
+	bmaj, bmin, bpat := semverParts(b)
+	switch {
+	case amaj != bmaj:
+		jumps = bmaj - amaj - 1
+		if bmin != 0 || bpat != 0 {
+			skipped = 1
+		}
+	case amin != bmin:
+		if bmin-amin > 1 || bpat != 0 {
+			skipped = 1
+		}
+	case bpat-apat > 1:
+		skipped = 1
+	}
+	return jumps, skipped
+}
+
+// semverParts returns the numeric major, minor, patch of a valid semver
+func semverParts(v string) (major, minor, patch int) {
+	v = strings.TrimPrefix(semver.Canonical(v), "v")
+	v = strings.SplitN(v, "-", 2)[0]
+	v = strings.SplitN(v, "+", 2)[0]
+	p := strings.SplitN(v, ".", 3)
+	if len(p) != 3 {
+		return 0, 0, 0
+	}
+	major, _ = strconv.Atoi(p[0])
+	minor, _ = strconv.Atoi(p[1])
+	patch, _ = strconv.Atoi(p[2])
+	return major, minor, patch
+}
+
+// outOfOrder counts releases published after a higher release
+func outOfOrder(releases []*pb.IndexRecord) int {
+	rs := make([]*pb.IndexRecord, len(releases))
+	copy(rs, releases)
+	ts := make(map[*pb.IndexRecord]time.Time, len(rs))
+	for _, r := range rs {
+		t, err := time.Parse(time.RFC3339Nano, r.Timestamp)
+		if err != nil {
+			log.Println(err)
+		}
+		ts[r] = t
+	}
+	sort.SliceStable(rs, func(i, j int) bool {
+		return ts[rs[i]].Before(ts[rs[j]])
+	})
+
+	var n int
+	var max string
+	for _, r := range rs {
+		if max != "" && semver.Compare(r.Version, max) < 0 {
+			n++
+		} else {
+			max = r.Version
+		}
+	}
+	return n
+}
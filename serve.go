@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.seankhliao.com/gomodstats/v2/pb"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// server answers json queries against the local dataset:
+//
+//	/modules/{path}                  versions of a module in the index
+//	/modules/{path}/@v/{version}     stored results for a module version
+//	/reports/                        report names
+//	/reports/{name}                  tables of a report, computed on first request
+//	/search?ident={ident}&limit={n}  selected module versions using an identifier
+type server struct {
+	policy string
+	pbi    *pb.Index
+	idx    map[string][]*pb.IndexRecord
+
+	// reports are computed one at a time as they share tableSink
+	mu      sync.Mutex
+	reports map[string]map[string]json.RawMessage
+
+	// idents is an inverted index of the selected versions,
+	// usable once ready is closed
+	ready    chan struct{}
+	selected []*pb.IndexRecord
+	idents   map[string][]posting
+}
+
+// posting is a use of an identifier count times in selected[rec]
+type posting struct {
+	rec, count int32
+}
+
+func newServer(pbi *pb.Index, policy string) (*server, error) {
+	if _, err := selectVersions(nil, policy); err != nil {
+		return nil, fmt.Errorf("newServer: %w", err)
+	}
+	// reports are built on request, check the flags they use up front
+	for _, name := range aggregatorNames {
+		_, err := aggregators(name)
+		if err != nil {
+			return nil, fmt.Errorf("newServer: %w", err)
+		}
+	}
+	return &server{
+		policy:  policy,
+		pbi:     pbi,
+		idx:     groupIndex(pbi),
+		reports: make(map[string]map[string]json.RawMessage),
+		ready:   make(chan struct{}),
+		idents:  make(map[string][]posting),
+	}, nil
+}
+
+// serve runs the json api on addr until it fails
+func serve(addr, policy string) {
+	pbi, err := Index(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	s, err := newServer(asOf(pbi, asof.Time), policy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go s.indexIdents()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/modules/", s.handleModules)
+	mux.HandleFunc("/reports/", s.handleReports)
+	mux.HandleFunc("/search", s.handleSearch)
+	log.Println("serve: listening on", addr)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+// indexIdents reads the selected version of every module for search
+func (s *server) indexIdents() {
+	ms := make([]string, 0, len(s.idx))
+	for m := range s.idx {
+		ms = append(ms, m)
+	}
+	sort.Strings(ms)
+	for _, m := range ms {
+		selected, _ := selectVersions(s.idx[m], s.policy)
+		for _, ir := range selected {
+			mv, err := loadModuleVersion(ir.Path, ir.Version)
+			if err != nil {
+				continue
+			}
+			rec := int32(len(s.selected))
+			s.selected = append(s.selected, ir)
+			for id, n := range mv.Idents {
+				s.idents[id] = append(s.idents[id], posting{rec, int32(n)})
+			}
+		}
+	}
+	log.Printf("serve: indexed %d idents in %d module versions", len(s.idents), len(s.selected))
+	close(s.ready)
+}
+
+func (s *server) handleModules(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, "/modules/")
+	m, v := p, ""
+	if i := strings.Index(p, "/@v/"); i >= 0 {
+		m, v = p[:i], p[i+len("/@v/"):]
+	}
+	irs, ok := s.idx[m]
+	if !ok {
+		serveError(w, http.StatusNotFound, fmt.Errorf("unknown module %q", m))
+		return
+	}
+
+	if v == "" {
+		type version struct {
+			Version   string `json:"version"`
+			Timestamp string `json:"timestamp"`
+		}
+		vs := make([]version, 0, len(irs))
+		for _, ir := range irs {
+			vs = append(vs, version{ir.Version, ir.Timestamp})
+		}
+		serveJSON(w, map[string]interface{}{
+			"path":     m,
+			"versions": vs,
+		})
+		return
+	}
+
+	var found bool
+	for _, ir := range irs {
+		found = found || ir.Version == v
+	}
+	if !found {
+		serveError(w, http.StatusNotFound, fmt.Errorf("unknown version %s@%s", m, v))
+		return
+	}
+	mv, err := loadModuleVersion(m, v)
+	if err != nil {
+		log.Println("serve", err)
+		serveError(w, http.StatusNotFound, fmt.Errorf("no stored results for %s@%s", m, v))
+		return
+	}
+	// the protobuf json mapping, encoding/json would also show generated internals
+	b, err := protojson.Marshal(mv)
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	_, err = w.Write(b)
+	if err != nil {
+		log.Println("serve", err)
+	}
+}
+
+func (s *server) handleReports(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/reports/")
+	if name == "" {
+		serveJSON(w, map[string]interface{}{"reports": aggregatorNames})
+		return
+	}
+	if _, ok := aggregatorFuncs[name]; !ok {
+		serveError(w, http.StatusNotFound, fmt.Errorf("unknown report %q, have %s", name, strings.Join(aggregatorNames, ",")))
+		return
+	}
+	tables, err := s.report(name)
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err)
+		return
+	}
+	serveJSON(w, map[string]interface{}{
+		"report": name,
+		"tables": tables,
+	})
+}
+
+// report runs a report over the whole dataset once,
+// keeping its tables as json arrays of row objects
+func (s *server) report(name string) (map[string]json.RawMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tables, ok := s.reports[name]; ok {
+		return tables, nil
+	}
+
+	aggs, err := aggregators(name)
+	if err != nil {
+		return nil, fmt.Errorf("report: %w", err)
+	}
+	tables := make(map[string]json.RawMessage)
+	var werr error
+	tableSink = func(t table) {
+		var b strings.Builder
+		if err := t.write(&b, "json"); err != nil && werr == nil {
+			werr = err
+		}
+		tables[t.name] = json.RawMessage(b.String())
+	}
+	err = aggregate(s.pbi, aggs, s.policy)
+	tableSink = nil
+	if err == nil {
+		err = werr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("report %s: %w", name, err)
+	}
+	s.reports[name] = tables
+	return tables, nil
+}
+
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	ident := r.FormValue("ident")
+	if ident == "" {
+		serveError(w, http.StatusBadRequest, fmt.Errorf("missing ident"))
+		return
+	}
+	n := 100
+	if l := r.FormValue("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 {
+			serveError(w, http.StatusBadRequest, fmt.Errorf("bad limit %q", l))
+			return
+		}
+		n = v
+	}
+	select {
+	case <-s.ready:
+	default:
+		serveError(w, http.StatusServiceUnavailable, fmt.Errorf("search index is still being built"))
+		return
+	}
+
+	ps := make([]posting, len(s.idents[ident]))
+	copy(ps, s.idents[ident])
+	sort.SliceStable(ps, func(i, j int) bool {
+		return ps[i].count > ps[j].count
+	})
+	type result struct {
+		Path    string `json:"path"`
+		Version string `json:"version"`
+		Count   int32  `json:"count"`
+	}
+	rs := make([]result, 0, len(ps))
+	for _, p := range ps {
+		if len(rs) == n {
+			break
+		}
+		ir := s.selected[p.rec]
+		rs = append(rs, result{ir.Path, ir.Version, p.count})
+	}
+	serveJSON(w, map[string]interface{}{
+		"ident":   ident,
+		"total":   len(ps),
+		"modules": rs,
+	})
+}
+
+func serveJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("content-type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Println("serveJSON", err)
+	}
+}
+
+func serveError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,1001 @@
+// Package sqlite writes SQLite 3 database files without cgo or a driver.
+//
+// It only supports bulk loading a new database:
+// tables are created, rows are appended with increasing rowids,
+// and indexes are built when the database is closed.
+// Index entries beyond what fits in memory are sorted in runs
+// in temporary files next to the database.
+// The result can be opened and queried by any SQLite implementation.
+//
+// File format reference: https://www.sqlite.org/fileformat.html
+package sqlite
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	pageSize = 4096
+	// usable size of a page, no reserved bytes
+	usable = pageSize
+
+	headerSize = 100
+	// SQLITE_VERSION_NUMBER recorded as the last writer
+	sqliteVersion = 3031001
+
+	typeIndexInterior = 0x02
+	typeTableInterior = 0x05
+	typeIndexLeaf     = 0x0a
+	typeTableLeaf     = 0x0d
+)
+
+// DB is a database file being written
+type DB struct {
+	f      *os.File
+	npages uint32
+	tables []*Table
+	err    error
+}
+
+// Table is a rowid table, rows are appended with Insert
+type Table struct {
+	db      *DB
+	name    string
+	columns []string
+	defs    []string
+	// alias is true if the first column is an INTEGER PRIMARY KEY
+	alias   bool
+	rowid   int64
+	leaf    *page
+	leaves  []child
+	indexes []*Index
+}
+
+// Index is an ascending index over columns of a table
+type Index struct {
+	name    string
+	columns []int
+	entries [][]interface{}
+
+	// runs holds sorted runs of entries back to back,
+	// run i starts at offsets[i] and the last one ends at size
+	runs    *os.File
+	offsets []int64
+	size    int64
+}
+
+// runEntries is the most entries an index keeps in memory
+// before they are sorted and spilled to its run file
+var runEntries = 1 << 16
+
+type child struct {
+	pgno uint32
+	key  int64
+}
+
+// Create creates or truncates the named file for writing a new database
+func Create(name string) (*DB, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite create %s: %w", name, err)
+	}
+	// page 1 is written last, it holds the header and schema
+	return &DB{f: f, npages: 1}, nil
+}
+
+// CreateTable adds a table, columns are definitions as in CREATE TABLE,
+// ex "id INTEGER PRIMARY KEY", "path TEXT".
+// If the first column is INTEGER PRIMARY KEY, its value is the rowid
+func (db *DB) CreateTable(name string, columns ...string) *Table {
+	t := &Table{
+		db:   db,
+		name: name,
+		defs: columns,
+		leaf: &page{typ: typeTableLeaf},
+	}
+	for i, c := range columns {
+		fs := strings.Fields(c)
+		t.columns = append(t.columns, fs[0])
+		if i == 0 && len(fs) == 4 && strings.EqualFold(strings.Join(fs[1:], " "), "INTEGER PRIMARY KEY") {
+			t.alias = true
+		}
+	}
+	db.tables = append(db.tables, t)
+	return t
+}
+
+// CreateIndex adds an index on columns of the table,
+// it must be called before any rows are inserted
+func (t *Table) CreateIndex(name string, columns ...string) error {
+	if t.rowid != 0 {
+		return fmt.Errorf("sqlite index %s: table %s already has rows", name, t.name)
+	}
+	idx := &Index{name: name}
+	for _, c := range columns {
+		i := t.column(c)
+		if i < 0 {
+			return fmt.Errorf("sqlite index %s: table %s has no column %s", name, t.name, c)
+		}
+		idx.columns = append(idx.columns, i)
+	}
+	t.indexes = append(t.indexes, idx)
+	return nil
+}
+
+func (t *Table) column(name string) int {
+	for i, c := range t.columns {
+		if c == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Insert appends a row and returns its rowid.
+// Values may be nil, bool, int, int64, float64, string or []byte.
+// For tables with an INTEGER PRIMARY KEY, a nil first value is assigned the next rowid,
+// other values must be larger than any previous rowid
+func (t *Table) Insert(values ...interface{}) (int64, error) {
+	if t.db.err != nil {
+		return 0, t.db.err
+	}
+	if len(values) != len(t.columns) {
+		return 0, fmt.Errorf("sqlite insert %s: %d values for %d columns", t.name, len(values), len(t.columns))
+	}
+	rowid := t.rowid + 1
+	if t.alias && values[0] != nil {
+		id, ok := integer(values[0])
+		if !ok || id <= t.rowid {
+			return 0, fmt.Errorf("sqlite insert %s: invalid rowid %v", t.name, values[0])
+		}
+		rowid = id
+	}
+	t.rowid = rowid
+
+	rec := values
+	if t.alias {
+		rec = append([]interface{}{nil}, values[1:]...)
+	}
+	payload, err := record(rec...)
+	if err != nil {
+		return 0, fmt.Errorf("sqlite insert %s: %w", t.name, err)
+	}
+	prefix := appendVarint(nil, uint64(len(payload)))
+	prefix = appendVarint(prefix, uint64(rowid))
+	cell, err := t.db.cell(prefix, payload, maxLocalTable)
+	if err != nil {
+		return 0, fmt.Errorf("sqlite insert %s: %w", t.name, err)
+	}
+	if !t.leaf.fits(cell) {
+		pgno, err := t.db.write(t.leaf)
+		if err != nil {
+			return 0, fmt.Errorf("sqlite insert %s: %w", t.name, err)
+		}
+		t.leaves = append(t.leaves, child{pgno, t.leaf.key})
+		t.leaf = &page{typ: typeTableLeaf}
+	}
+	t.leaf.add(cell)
+	t.leaf.key = rowid
+
+	for _, idx := range t.indexes {
+		e := make([]interface{}, 0, len(idx.columns)+1)
+		for _, c := range idx.columns {
+			v := values[c]
+			if c == 0 && t.alias {
+				v = rowid
+			}
+			e = append(e, v)
+		}
+		idx.entries = append(idx.entries, append(e, rowid))
+		if len(idx.entries) >= runEntries {
+			err = t.db.spill(idx)
+			if err != nil {
+				return 0, fmt.Errorf("sqlite insert %s: %w", t.name, err)
+			}
+		}
+	}
+	return rowid, nil
+}
+
+// Close writes the indexes and schema and closes the file
+func (db *DB) Close() error {
+	err := db.close()
+	for _, t := range db.tables {
+		for _, idx := range t.indexes {
+			idx.removeRuns()
+		}
+	}
+	cerr := db.f.Close()
+	if err != nil {
+		return err
+	} else if cerr != nil {
+		return fmt.Errorf("sqlite close: %w", cerr)
+	}
+	return nil
+}
+
+func (db *DB) close() error {
+	if db.err != nil {
+		return db.err
+	}
+	var schema [][]byte
+	addSchema := func(typ, name, tbl string, root uint32, sql string) error {
+		payload, err := record(typ, name, tbl, int64(root), sql)
+		if err != nil {
+			return err
+		}
+		prefix := appendVarint(nil, uint64(len(payload)))
+		prefix = appendVarint(prefix, uint64(len(schema)+1))
+		cell, err := db.cell(prefix, payload, maxLocalTable)
+		if err != nil {
+			return err
+		}
+		schema = append(schema, cell)
+		return nil
+	}
+
+	for _, t := range db.tables {
+		root, err := db.tableTree(t)
+		if err != nil {
+			return fmt.Errorf("sqlite table %s: %w", t.name, err)
+		}
+		sql := fmt.Sprintf("CREATE TABLE %s (%s)", t.name, strings.Join(t.defs, ", "))
+		err = addSchema("table", t.name, t.name, root, sql)
+		if err != nil {
+			return fmt.Errorf("sqlite table %s: %w", t.name, err)
+		}
+	}
+	for _, t := range db.tables {
+		for _, idx := range t.indexes {
+			root, err := db.indexTree(idx)
+			if err != nil {
+				return fmt.Errorf("sqlite index %s: %w", idx.name, err)
+			}
+			cols := make([]string, 0, len(idx.columns))
+			for _, c := range idx.columns {
+				cols = append(cols, t.columns[c])
+			}
+			sql := fmt.Sprintf("CREATE INDEX %s ON %s (%s)", idx.name, t.name, strings.Join(cols, ", "))
+			err = addSchema("index", idx.name, t.name, root, sql)
+			if err != nil {
+				return fmt.Errorf("sqlite index %s: %w", idx.name, err)
+			}
+		}
+	}
+
+	err := db.schemaTree(schema)
+	if err != nil {
+		return fmt.Errorf("sqlite schema: %w", err)
+	}
+	return nil
+}
+
+// schemaTree writes the sqlite_schema table from its cells, with rowids from 1.
+// Its root is page 1 after the header, so if the cells don't fit there
+// they go in leaves under an interior root
+func (db *DB) schemaTree(cells [][]byte) error {
+	root := &page{typ: typeTableLeaf, offset: headerSize}
+	for _, c := range cells {
+		if !root.fits(c) {
+			root = nil
+			break
+		}
+		root.add(c)
+	}
+
+	if root == nil {
+		var children []child
+		leaf := &page{typ: typeTableLeaf}
+		for i, c := range cells {
+			if !leaf.fits(c) {
+				pgno, err := db.write(leaf)
+				if err != nil {
+					return err
+				}
+				children = append(children, child{pgno, leaf.key})
+				leaf = &page{typ: typeTableLeaf}
+			}
+			leaf.add(c)
+			leaf.key = int64(i + 1)
+		}
+		pgno, err := db.write(leaf)
+		if err != nil {
+			return err
+		}
+		children, err = db.interior(append(children, child{pgno, leaf.key}), maxRootCells)
+		if err != nil {
+			return err
+		}
+		root = &page{typ: typeTableInterior, offset: headerSize}
+		for _, c := range children[:len(children)-1] {
+			root.add(interiorCell(c))
+		}
+		root.right = children[len(children)-1].pgno
+	}
+
+	b := root.encode()
+	copy(b, db.header())
+	_, err := db.f.WriteAt(b, 0)
+	if err != nil {
+		return fmt.Errorf("write page 1: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) header() []byte {
+	h := make([]byte, headerSize)
+	copy(h, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(h[16:], pageSize)
+	h[18], h[19] = 1, 1 // legacy rollback journal
+	h[20] = 0           // reserved bytes per page
+	h[21], h[22], h[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(h[24:], 1) // file change counter
+	binary.BigEndian.PutUint32(h[28:], db.npages)
+	binary.BigEndian.PutUint32(h[40:], 1) // schema cookie
+	binary.BigEndian.PutUint32(h[44:], 4) // schema format
+	binary.BigEndian.PutUint32(h[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(h[92:], 1) // version valid for
+	binary.BigEndian.PutUint32(h[96:], sqliteVersion)
+	return h
+}
+
+// tableTree flushes the last leaf of a table and builds its interior pages,
+// returning the root page
+func (db *DB) tableTree(t *Table) (uint32, error) {
+	pgno, err := db.write(t.leaf)
+	if err != nil {
+		return 0, err
+	}
+	children, err := db.interior(append(t.leaves, child{pgno, t.leaf.key}), 1)
+	if err != nil {
+		return 0, err
+	}
+	return children[0].pgno, nil
+}
+
+// interior writes levels of table interior pages over children
+// until at most n are left
+func (db *DB) interior(children []child, n int) ([]child, error) {
+	for len(children) > n {
+		var parents []child
+		for _, group := range groups(children, maxInteriorCells+1) {
+			p := &page{typ: typeTableInterior}
+			for _, c := range group[:len(group)-1] {
+				p.add(interiorCell(c))
+			}
+			last := group[len(group)-1]
+			p.right, p.key = last.pgno, last.key
+			pgno, err := db.write(p)
+			if err != nil {
+				return nil, err
+			}
+			parents = append(parents, child{pgno, p.key})
+		}
+		children = parents
+	}
+	return children, nil
+}
+
+func interiorCell(c child) []byte {
+	return appendVarint(appendUint32(nil, c.pgno), uint64(c.key))
+}
+
+// table interior cells are at most a 4 byte page number and a 9 byte varint
+const (
+	maxInteriorCells = (usable - 12) / (2 + 4 + 9)
+	maxRootCells     = (usable - headerSize - 12) / (2 + 4 + 9)
+)
+
+// groups splits children into groups of at most n, each with at least 2
+func groups(children []child, n int) [][]child {
+	var gs [][]child
+	for len(children) > n {
+		k := n
+		if len(children)-k < 2 {
+			k--
+		}
+		gs = append(gs, children[:k])
+		children = children[k:]
+	}
+	return append(gs, children)
+}
+
+// indexTree sorts the index entries and writes them as a b-tree,
+// returning the root page.
+// Pages are filled left to right, when an entry does not fit in a page,
+// the page's last entry moves up a level as the divider
+func (db *DB) indexTree(idx *Index) (uint32, error) {
+	next, err := db.sorted(idx)
+	if err != nil {
+		return 0, err
+	}
+
+	// levels[0] is the leaf level.
+	// body is a cell without its left child pointer,
+	// it is the same for leaf and interior index cells
+	levels := []*page{{typ: typeIndexLeaf}}
+	var push func(level int, body []byte, left uint32) error
+	push = func(level int, body []byte, left uint32) error {
+		if level == len(levels) {
+			levels = append(levels, &page{typ: typeIndexInterior})
+		}
+		p := levels[level]
+		cell := body
+		if level > 0 {
+			cell = append(appendUint32(nil, left), body...)
+		}
+		if !p.fits(cell) {
+			last := p.pop()
+			if level > 0 {
+				// the divider's left child becomes this page's right-most child
+				p.right = binary.BigEndian.Uint32(last)
+				last = last[4:]
+			}
+			pgno, err := db.write(p)
+			if err != nil {
+				return err
+			}
+			levels[level] = &page{typ: p.typ}
+			err = push(level+1, last, pgno)
+			if err != nil {
+				return err
+			}
+			p = levels[level]
+		}
+		p.add(cell)
+		return nil
+	}
+
+	for {
+		payload, err := next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		body, err := db.cell(appendVarint(nil, uint64(len(payload))), payload, maxLocalIndex)
+		if err != nil {
+			return 0, err
+		}
+		err = push(0, body, 0)
+		if err != nil {
+			return 0, err
+		}
+	}
+	idx.entries = nil
+	idx.removeRuns()
+
+	var pgno uint32
+	for i, p := range levels {
+		if i > 0 {
+			p.right = pgno
+		}
+		var err error
+		pgno, err = db.write(p)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return pgno, nil
+}
+
+func sortEntries(es [][]interface{}) {
+	sort.Slice(es, func(i, j int) bool {
+		return compareRecords(es[i], es[j]) < 0
+	})
+}
+
+// spill sorts the entries in memory and appends them to the index's run file
+// as records, each prefixed by its 4 byte length
+func (db *DB) spill(idx *Index) error {
+	if idx.runs == nil {
+		f, err := os.CreateTemp(filepath.Dir(db.f.Name()), filepath.Base(db.f.Name())+"."+idx.name+".*")
+		if err != nil {
+			db.err = fmt.Errorf("sqlite index %s: %w", idx.name, err)
+			return db.err
+		}
+		idx.runs = f
+	}
+	sortEntries(idx.entries)
+	idx.offsets = append(idx.offsets, idx.size)
+	w := bufio.NewWriter(idx.runs)
+	for _, e := range idx.entries {
+		rec, err := record(e...)
+		if err != nil {
+			return fmt.Errorf("sqlite index %s: %w", idx.name, err)
+		}
+		w.Write(appendUint32(nil, uint32(len(rec))))
+		w.Write(rec)
+		idx.size += 4 + int64(len(rec))
+	}
+	err := w.Flush()
+	if err != nil {
+		db.err = fmt.Errorf("sqlite index %s spill: %w", idx.name, err)
+		return db.err
+	}
+	idx.entries = idx.entries[:0]
+	return nil
+}
+
+// sorted returns an iterator over the index entries as records in order,
+// merging the runs if any were spilled
+func (db *DB) sorted(idx *Index) (func() ([]byte, error), error) {
+	if idx.runs == nil {
+		sortEntries(idx.entries)
+		es := idx.entries
+		return func() ([]byte, error) {
+			if len(es) == 0 {
+				return nil, io.EOF
+			}
+			e := es[0]
+			es = es[1:]
+			return record(e...)
+		}, nil
+	}
+
+	if len(idx.entries) > 0 {
+		err := db.spill(idx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var h runHeap
+	for i, off := range idx.offsets {
+		end := idx.size
+		if i+1 < len(idx.offsets) {
+			end = idx.offsets[i+1]
+		}
+		r := &run{r: bufio.NewReader(io.NewSectionReader(idx.runs, off, end-off))}
+		err := r.next()
+		if err != nil {
+			return nil, fmt.Errorf("read run %d: %w", i, err)
+		}
+		h = append(h, r)
+	}
+	heap.Init(&h)
+	return func() ([]byte, error) {
+		if len(h) == 0 {
+			return nil, io.EOF
+		}
+		r := h[0]
+		rec := r.rec
+		err := r.next()
+		if err == io.EOF {
+			heap.Pop(&h)
+		} else if err != nil {
+			return nil, fmt.Errorf("read run: %w", err)
+		} else {
+			heap.Fix(&h, 0)
+		}
+		return rec, nil
+	}, nil
+}
+
+// removeRuns deletes the index's run file if it has one
+func (idx *Index) removeRuns() {
+	if idx.runs != nil {
+		idx.runs.Close()
+		os.Remove(idx.runs.Name())
+		idx.runs = nil
+	}
+}
+
+// run reads a sorted run of records, rec is the current one
+type run struct {
+	r    *bufio.Reader
+	rec  []byte
+	vals []interface{}
+}
+
+func (r *run) next() error {
+	var n [4]byte
+	_, err := io.ReadFull(r.r, n[:])
+	if err != nil {
+		return err
+	}
+	r.rec = make([]byte, binary.BigEndian.Uint32(n[:]))
+	_, err = io.ReadFull(r.r, r.rec)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	r.vals, err = parseRecord(r.rec)
+	return err
+}
+
+// runHeap orders runs by their current record
+type runHeap []*run
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return compareRecords(h[i].vals, h[j].vals) < 0 }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*run)) }
+func (h *runHeap) Pop() interface{} {
+	r := (*h)[len(*h)-1]
+	*h = (*h)[:len(*h)-1]
+	return r
+}
+
+// write allocates a page and writes p to it
+func (db *DB) write(p *page) (uint32, error) {
+	db.npages++
+	pgno := db.npages
+	_, err := db.f.WriteAt(p.encode(), int64(pgno-1)*pageSize)
+	if err != nil {
+		db.err = fmt.Errorf("sqlite write page %d: %w", pgno, err)
+		return 0, db.err
+	}
+	return pgno, nil
+}
+
+const (
+	maxLocalTable = usable - 35
+	maxLocalIndex = (usable-12)*64/255 - 23
+	minLocal      = (usable-12)*32/255 - 23
+)
+
+// cell builds a cell from its prefix (child pointer, sizes, rowid) and payload,
+// spilling the part of the payload that is not stored locally to overflow pages
+func (db *DB) cell(prefix, payload []byte, maxLocal int) ([]byte, error) {
+	if len(payload) <= maxLocal {
+		return append(prefix, payload...), nil
+	}
+	local := minLocal + (len(payload)-minLocal)%(usable-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	cell := append(prefix, payload[:local]...)
+
+	rest := payload[local:]
+	n := (len(rest) + usable - 5) / (usable - 4)
+	first := db.npages + 1
+	for i := 0; i < n; i++ {
+		b := make([]byte, pageSize)
+		if i < n-1 {
+			binary.BigEndian.PutUint32(b, first+uint32(i)+1)
+		}
+		end := usable - 4
+		if end > len(rest) {
+			end = len(rest)
+		}
+		copy(b[4:], rest[:end])
+		rest = rest[end:]
+		db.npages++
+		_, err := db.f.WriteAt(b, int64(db.npages-1)*pageSize)
+		if err != nil {
+			db.err = fmt.Errorf("sqlite write overflow page %d: %w", db.npages, err)
+			return nil, db.err
+		}
+	}
+	return appendUint32(cell, first), nil
+}
+
+// page is a b-tree page being filled
+type page struct {
+	typ    byte
+	offset int // 100 for the first page
+	cells  [][]byte
+	used   int
+	right  uint32
+	// key is the largest rowid in a table page's subtree
+	key int64
+}
+
+func (p *page) headerLen() int {
+	if p.typ == typeTableInterior || p.typ == typeIndexInterior {
+		return 12
+	}
+	return 8
+}
+
+func (p *page) fits(cell []byte) bool {
+	return p.offset+p.headerLen()+p.used+2+len(cell) <= usable
+}
+
+func (p *page) add(cell []byte) {
+	p.cells = append(p.cells, cell)
+	p.used += 2 + len(cell)
+}
+
+func (p *page) pop() []byte {
+	c := p.cells[len(p.cells)-1]
+	p.cells = p.cells[:len(p.cells)-1]
+	p.used -= 2 + len(c)
+	return c
+}
+
+func (p *page) encode() []byte {
+	b := make([]byte, pageSize)
+	h := b[p.offset:]
+	h[0] = p.typ
+	binary.BigEndian.PutUint16(h[3:], uint16(len(p.cells)))
+	ptr := p.headerLen()
+	if ptr == 12 {
+		binary.BigEndian.PutUint32(h[8:], p.right)
+	}
+	end := usable
+	for _, c := range p.cells {
+		end -= len(c)
+		copy(b[end:], c)
+		binary.BigEndian.PutUint16(h[ptr:], uint16(end))
+		ptr += 2
+	}
+	// 0 is interpreted as 65536
+	binary.BigEndian.PutUint16(h[5:], uint16(end))
+	return b
+}
+
+// record encodes values in the record format
+func record(values ...interface{}) ([]byte, error) {
+	var hdr, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			hdr = appendVarint(hdr, 0)
+		case float64:
+			hdr = appendVarint(hdr, 7)
+			body = appendUint64(body, math.Float64bits(v))
+		case string:
+			hdr = appendVarint(hdr, uint64(len(v))*2+13)
+			body = append(body, v...)
+		case []byte:
+			hdr = appendVarint(hdr, uint64(len(v))*2+12)
+			body = append(body, v...)
+		default:
+			i, ok := integer(v)
+			if !ok {
+				return nil, fmt.Errorf("unsupported value type %T", v)
+			}
+			t, n := intSerial(i)
+			hdr = appendVarint(hdr, t)
+			for k := n - 1; k >= 0; k-- {
+				body = append(body, byte(i>>(8*k)))
+			}
+		}
+	}
+	// the header size includes its own varint
+	n := len(hdr) + 1
+	for n != len(hdr)+varintLen(uint64(n)) {
+		n = len(hdr) + varintLen(uint64(n))
+	}
+	rec := appendVarint(nil, uint64(n))
+	rec = append(rec, hdr...)
+	return append(rec, body...), nil
+}
+
+// parseRecord decodes a record, integers are returned as int64
+func parseRecord(b []byte) ([]interface{}, error) {
+	n, k := readVarint(b)
+	if k == 0 || n > uint64(len(b)) {
+		return nil, fmt.Errorf("bad record header size %d", n)
+	}
+	hdr, body := b[k:n], b[n:]
+	var vs []interface{}
+	for len(hdr) > 0 {
+		t, k := readVarint(hdr)
+		if k == 0 {
+			return nil, fmt.Errorf("bad record header")
+		}
+		hdr = hdr[k:]
+		var size int
+		switch {
+		case t <= 4:
+			size = int(t)
+		case t == 5:
+			size = 6
+		case t == 6 || t == 7:
+			size = 8
+		case t >= 12:
+			size = int(t-12) / 2
+		}
+		if size > len(body) {
+			return nil, fmt.Errorf("short record body")
+		}
+		v := body[:size]
+		body = body[size:]
+		switch {
+		case t == 0:
+			vs = append(vs, nil)
+		case t == 7:
+			vs = append(vs, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case t == 8 || t == 9:
+			vs = append(vs, int64(t-8))
+		case t >= 12 && t%2 == 0:
+			vs = append(vs, append([]byte{}, v...))
+		case t >= 13:
+			vs = append(vs, string(v))
+		case t <= 6:
+			i := int64(int8(v[0]))
+			for _, c := range v[1:] {
+				i = i<<8 | int64(c)
+			}
+			vs = append(vs, i)
+		default:
+			return nil, fmt.Errorf("unsupported serial type %d", t)
+		}
+	}
+	return vs, nil
+}
+
+func integer(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// intSerial returns the serial type and byte length for an integer
+func intSerial(i int64) (uint64, int) {
+	switch {
+	case i == 0:
+		return 8, 0
+	case i == 1:
+		return 9, 0
+	case i >= -1<<7 && i < 1<<7:
+		return 1, 1
+	case i >= -1<<15 && i < 1<<15:
+		return 2, 2
+	case i >= -1<<23 && i < 1<<23:
+		return 3, 3
+	case i >= -1<<31 && i < 1<<31:
+		return 4, 4
+	case i >= -1<<47 && i < 1<<47:
+		return 5, 6
+	}
+	return 6, 8
+}
+
+// compareRecords orders index entries as SQLite does with BINARY collation:
+// NULL, then numbers, then text, then blobs
+func compareRecords(a, b []interface{}) int {
+	for i := range a {
+		if c := compareValues(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareValues(a, b interface{}) int {
+	ca, cb := class(a), class(b)
+	if ca != cb {
+		if ca < cb {
+			return -1
+		}
+		return 1
+	}
+	switch ca {
+	case 1:
+		fa, fb := number(a), number(b)
+		if ia, ok := integer(a); ok {
+			if ib, ok := integer(b); ok {
+				fa, fb = 0, 0
+				switch {
+				case ia < ib:
+					fa = -1
+				case ia > ib:
+					fa = 1
+				}
+			}
+		}
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+	case 2:
+		return strings.Compare(a.(string), b.(string))
+	case 3:
+		return bytes.Compare(a.([]byte), b.([]byte))
+	}
+	return 0
+}
+
+func class(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case string:
+		return 2
+	case []byte:
+		return 3
+	}
+	return 1
+}
+
+func number(v interface{}) float64 {
+	if f, ok := v.(float64); ok {
+		return f
+	}
+	i, _ := integer(v)
+	return float64(i)
+}
+
+// appendVarint appends a SQLite varint (big endian, 7 bits per byte, last byte 8 bits)
+func appendVarint(b []byte, v uint64) []byte {
+	if v <= 0x7f {
+		return append(b, byte(v))
+	}
+	if v > 0x00ffffffffffffff {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+	var buf [9]byte
+	n := 0
+	for v > 0 {
+		buf[n] = byte(v & 0x7f)
+		v >>= 7
+		n++
+	}
+	for i := n - 1; i >= 0; i-- {
+		c := buf[i]
+		if i > 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// readVarint decodes a SQLite varint, returning its value and length,
+// or 0 length if b is too short
+func readVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func varintLen(v uint64) int {
+	return len(appendVarint(nil, v))
+}
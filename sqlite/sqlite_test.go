@@ -0,0 +1,341 @@
+package sqlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecord(t *testing.T) {
+	tests := [][]interface{}{
+		{nil, int64(0), int64(1), int64(-1), int64(127), int64(-128)},
+		{int64(1 << 15), int64(-1 << 23), int64(1<<31 - 1), int64(-1 << 47), int64(1<<63 - 1)},
+		{1.5, "", "text", []byte{}, []byte{0, 1, 2}},
+		{strings.Repeat("x", 300)},
+		{},
+	}
+	for _, vs := range tests {
+		b, err := record(vs...)
+		if err != nil {
+			t.Fatalf("record(%v): %v", vs, err)
+		}
+		got, err := parseRecord(b)
+		if err != nil {
+			t.Fatalf("parseRecord(%v): %v", vs, err)
+		}
+		if len(got) != len(vs) || (len(vs) > 0 && !reflect.DeepEqual(got, vs)) {
+			t.Errorf("parseRecord(record(%v)) = %v", vs, got)
+		}
+	}
+}
+
+func TestVarint(t *testing.T) {
+	for _, v := range []uint64{0, 0x7f, 0x80, 0x3fff, 0x4000, 1<<56 - 1, 1 << 56, 1<<64 - 1} {
+		b := appendVarint(nil, v)
+		got, n := readVarint(b)
+		if got != v || n != len(b) {
+			t.Errorf("readVarint(appendVarint(%#x)) = %#x, %d, want %d bytes", v, got, n, len(b))
+		}
+	}
+}
+
+type testRow struct {
+	name string
+	n    int64
+	data []byte
+}
+
+func testRows(n int) []testRow {
+	rows := make([]testRow, n)
+	for i := range rows {
+		rows[i] = testRow{
+			name: fmt.Sprintf("name-%d", (i*7919)%n),
+			n:    int64(i % 13),
+		}
+		if i%500 == 0 {
+			// larger than a page, stored in overflow pages
+			rows[i].data = bytes.Repeat([]byte{byte(i)}, 3*pageSize)
+		}
+	}
+	return rows
+}
+
+// writeTestDB writes rows and ntables extra tables to a new database in dir
+func writeTestDB(t *testing.T, dir string, rows []testRow, ntables int) string {
+	fn := filepath.Join(dir, "test.db")
+	db, err := Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl := db.CreateTable("rows", "id INTEGER PRIMARY KEY", "name TEXT", "n INTEGER", "data BLOB")
+	for _, idx := range []struct {
+		name string
+		cols []string
+	}{
+		{"rows_name", []string{"name"}},
+		{"rows_n", []string{"n", "name"}},
+	} {
+		err = tbl.CreateIndex(idx.name, idx.cols...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < ntables; i++ {
+		db.CreateTable(fmt.Sprintf("extra_%d", i), "a_long_column_name_to_fill_the_schema TEXT", "another_long_column_name INTEGER")
+	}
+	for i, r := range rows {
+		var data interface{}
+		if r.data != nil {
+			data = r.data
+		}
+		id, err := tbl.Insert(nil, r.name, r.n, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != int64(i+1) {
+			t.Fatalf("Insert row %d = rowid %d", i, id)
+		}
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+func TestWrite(t *testing.T) {
+	defer func(n int) { runEntries = n }(runEntries)
+	for _, tt := range []struct {
+		name       string
+		runEntries int
+		rows       int
+		tables     int
+	}{
+		{"empty", runEntries, 0, 0},
+		{"memory", runEntries, 3000, 0},
+		{"spilled", 256, 3000, 0},
+		{"schema pages", runEntries, 10, 100},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			runEntries = tt.runEntries
+			dir := t.TempDir()
+			rows := testRows(tt.rows)
+			fn := writeTestDB(t, dir, rows, tt.tables)
+			b, err := os.ReadFile(fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ents, _ := os.ReadDir(dir); len(ents) != 1 {
+				t.Errorf("run files left behind: %d files in dir", len(ents))
+			}
+			checkFile(t, b, rows, tt.tables)
+		})
+	}
+}
+
+func checkFile(t *testing.T, b []byte, rows []testRow, ntables int) {
+	t.Helper()
+	if !bytes.HasPrefix(b, []byte("SQLite format 3\x00")) {
+		t.Fatalf("bad magic %q", b[:16])
+	}
+	if n := binary.BigEndian.Uint32(b[28:]); int(n)*pageSize != len(b) {
+		t.Fatalf("header has %d pages, file has %d bytes", n, len(b))
+	}
+	r := reader{t, b}
+
+	roots := make(map[string]int64)
+	schema := r.table(1)
+	if len(schema) != 3+ntables {
+		t.Fatalf("schema has %d rows, want %d", len(schema), 3+ntables)
+	}
+	for i, row := range schema {
+		if row.rowid != int64(i+1) {
+			t.Errorf("schema row %d has rowid %d", i, row.rowid)
+		}
+		roots[row.vals[1].(string)] = row.vals[3].(int64)
+	}
+	for i := 0; i < ntables; i++ {
+		if _, ok := roots[fmt.Sprintf("extra_%d", i)]; !ok {
+			t.Errorf("schema missing extra_%d", i)
+		}
+	}
+
+	got := r.table(uint32(roots["rows"]))
+	if len(got) != len(rows) {
+		t.Fatalf("rows has %d rows, want %d", len(got), len(rows))
+	}
+	for i, row := range got {
+		want := []interface{}{nil, rows[i].name, rows[i].n, nil}
+		if rows[i].data != nil {
+			want[3] = rows[i].data
+		}
+		if row.rowid != int64(i+1) || !reflect.DeepEqual(row.vals, want) {
+			t.Fatalf("row %d = %d %.40v, want %.40v", i, row.rowid, row.vals, want)
+		}
+	}
+
+	for name, cols := range map[string]func(testRow) []interface{}{
+		"rows_name": func(r testRow) []interface{} { return []interface{}{r.name} },
+		"rows_n":    func(r testRow) []interface{} { return []interface{}{r.n, r.name} },
+	} {
+		es := r.index(uint32(roots[name]))
+		if len(es) != len(rows) {
+			t.Fatalf("%s has %d entries, want %d", name, len(es), len(rows))
+		}
+		for i, e := range es {
+			if i > 0 && compareRecords(es[i-1], e) >= 0 {
+				t.Fatalf("%s entry %d %v is not after %v", name, i, e, es[i-1])
+			}
+			rowid := e[len(e)-1].(int64)
+			if want := append(cols(rows[rowid-1]), rowid); !reflect.DeepEqual(e, want) {
+				t.Fatalf("%s entry %d = %v, want %v", name, i, e, want)
+			}
+		}
+	}
+}
+
+// reader walks the b-trees of a database file
+type reader struct {
+	t *testing.T
+	b []byte
+}
+
+type readRow struct {
+	rowid int64
+	vals  []interface{}
+}
+
+func (r reader) page(pgno uint32) (hdr []byte, cells [][]byte) {
+	r.t.Helper()
+	if pgno < 1 || int(pgno)*pageSize > len(r.b) {
+		r.t.Fatalf("page %d out of range", pgno)
+	}
+	p := r.b[int(pgno-1)*pageSize : int(pgno)*pageSize]
+	hdr = p
+	if pgno == 1 {
+		hdr = p[headerSize:]
+	}
+	n := int(binary.BigEndian.Uint16(hdr[3:]))
+	ptrs := hdr[8:]
+	if hdr[0] == typeTableInterior || hdr[0] == typeIndexInterior {
+		ptrs = hdr[12:]
+	}
+	for i := 0; i < n; i++ {
+		cells = append(cells, p[binary.BigEndian.Uint16(ptrs[2*i:]):])
+	}
+	return hdr, cells
+}
+
+// payload reads a payload of size n starting at b, following overflow pages
+func (r reader) payload(b []byte, n, maxLocal int) []byte {
+	if n <= maxLocal {
+		return b[:n]
+	}
+	local := minLocal + (n-minLocal)%(usable-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	p := append([]byte{}, b[:local]...)
+	next := binary.BigEndian.Uint32(b[local:])
+	for len(p) < n {
+		o := r.b[int(next-1)*pageSize : int(next)*pageSize]
+		k := n - len(p)
+		if k > usable-4 {
+			k = usable - 4
+		}
+		p = append(p, o[4:4+k]...)
+		next = binary.BigEndian.Uint32(o)
+	}
+	return p
+}
+
+func (r reader) record(b []byte) []interface{} {
+	r.t.Helper()
+	vs, err := parseRecord(b)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return vs
+}
+
+// table returns the rows of the table rooted at pgno in rowid order
+func (r reader) table(pgno uint32) []readRow {
+	r.t.Helper()
+	hdr, cells := r.page(pgno)
+	var rows []readRow
+	switch hdr[0] {
+	case typeTableInterior:
+		for _, c := range cells {
+			rows = append(rows, r.table(binary.BigEndian.Uint32(c))...)
+		}
+		return append(rows, r.table(binary.BigEndian.Uint32(hdr[8:]))...)
+	case typeTableLeaf:
+		for _, c := range cells {
+			n, k1 := readVarint(c)
+			rowid, k2 := readVarint(c[k1:])
+			rows = append(rows, readRow{int64(rowid), r.record(r.payload(c[k1+k2:], int(n), maxLocalTable))})
+		}
+		return rows
+	}
+	r.t.Fatalf("page %d has type %#x, want a table page", pgno, hdr[0])
+	return nil
+}
+
+// index returns the entries of the index rooted at pgno in tree order
+func (r reader) index(pgno uint32) [][]interface{} {
+	r.t.Helper()
+	hdr, cells := r.page(pgno)
+	var es [][]interface{}
+	switch hdr[0] {
+	case typeIndexInterior:
+		for _, c := range cells {
+			es = append(es, r.index(binary.BigEndian.Uint32(c))...)
+			n, k := readVarint(c[4:])
+			es = append(es, r.record(r.payload(c[4+k:], int(n), maxLocalIndex)))
+		}
+		return append(es, r.index(binary.BigEndian.Uint32(hdr[8:]))...)
+	case typeIndexLeaf:
+		for _, c := range cells {
+			n, k := readVarint(c)
+			es = append(es, r.record(r.payload(c[k:], int(n), maxLocalIndex)))
+		}
+		return es
+	}
+	r.t.Fatalf("page %d has type %#x, want an index page", pgno, hdr[0])
+	return nil
+}
+
+// TestSQLite3 checks written files with the sqlite3 command if it is installed
+func TestSQLite3(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not found")
+	}
+	defer func(n int) { runEntries = n }(runEntries)
+	runEntries = 256
+	rows := testRows(3000)
+	fn := writeTestDB(t, t.TempDir(), rows, 100)
+
+	for _, tt := range []struct {
+		sql, want string
+	}{
+		{"PRAGMA integrity_check", "ok"},
+		{"SELECT count(*) FROM sqlite_schema", "103"},
+		{"SELECT count(*), sum(n), sum(length(data)) FROM rows", fmt.Sprintf("3000|17985|%d", 6*3*pageSize)},
+		{"SELECT id FROM rows INDEXED BY rows_name WHERE name = 'name-42'", "1519"},
+		{"SELECT count(*) FROM rows INDEXED BY rows_n WHERE n = 12", "230"},
+	} {
+		out, err := exec.Command("sqlite3", fn, tt.sql).CombinedOutput()
+		if err != nil {
+			t.Fatalf("sqlite3 %q: %v\n%s", tt.sql, err, out)
+		}
+		if got := strings.TrimSpace(string(out)); got != tt.want {
+			t.Errorf("sqlite3 %q = %s, want %s", tt.sql, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.seankhliao.com/gomodstats/v2/pb"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// timeseriesAggregator buckets index records by publish time at the given interval
+// (hour, day, week, month) and dimension (host, major, delay or none),
+// writing bucket,key,count,cumulative rows
+type timeseriesAggregator struct {
+	interval string
+	dim      string
+	counts   map[string]map[string]int64
+}
+
+func newTimeseriesAggregator(interval, dim string) (*timeseriesAggregator, error) {
+	_, err := bucket(time.Time{}, interval)
+	if err != nil {
+		return nil, fmt.Errorf("newTimeseriesAggregator: %w", err)
+	}
+	err = checkDimension(dim)
+	if err != nil {
+		return nil, fmt.Errorf("newTimeseriesAggregator: %w", err)
+	}
+	return &timeseriesAggregator{
+		interval: interval,
+		dim:      dim,
+		counts:   make(map[string]map[string]int64),
+	}, nil
+}
+
+func (a *timeseriesAggregator) Name() string { return "timeseries" }
+
+func (a *timeseriesAggregator) Record(r *pb.IndexRecord) error {
+	t, err := time.Parse(time.RFC3339Nano, r.Timestamp)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	b, err := bucket(t, a.interval)
+	if err != nil {
+		return err
+	}
+	k := dimension(r, a.dim)
+	if a.counts[k] == nil {
+		a.counts[k] = make(map[string]int64)
+	}
+	a.counts[k][b]++
+	return nil
+}
+
+func (a *timeseriesAggregator) Write() error {
+	keys := make([]string, 0, len(a.counts))
+	for k := range a.counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fn := "timeseries-" + a.interval
+	if a.dim != "" {
+		fn = "timeseries-" + a.interval + "-" + a.dim
+	}
+	var rows [][]string
+	for _, k := range keys {
+		bs := make([]string, 0, len(a.counts[k]))
+		for b := range a.counts[k] {
+			bs = append(bs, b)
+		}
+		// bucket formats sort chronologically
+		sort.Strings(bs)
+		var cum int64
+		for _, b := range bs {
+			cum += a.counts[k][b]
+			rows = append(rows, []string{b, k, strconv.FormatInt(a.counts[k][b], 10), strconv.FormatInt(cum, 10)})
+		}
+	}
+	return writeTable(fn, []string{"bucket", "key", "count:int", "cumulative:int"}, rows)
+}
+
+// bucket formats the start of the interval containing t,
+// weeks start on Monday
+func bucket(t time.Time, interval string) (string, error) {
+	t = t.UTC()
+	switch interval {
+	case "hour":
+		return t.Format("2006-01-02T15"), nil
+	case "day":
+		return t.Format("2006-01-02"), nil
+	case "week":
+		t = t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+		return t.Format("2006-01-02"), nil
+	case "month":
+		return t.Format("2006-01"), nil
+	}
+	return "", fmt.Errorf("bucket: unknown interval %q", interval)
+}
+
+// checkDimension rejects dimensions that dimension doesn't know,
+// they would silently group everything under all
+func checkDimension(dim string) error {
+	switch dim {
+	case "", "host", "major", "delay":
+		return nil
+	}
+	return fmt.Errorf("checkDimension: unknown dimension %q, have host, major, delay", dim)
+}
+
+// dimension returns the key a record is grouped under
+func dimension(r *pb.IndexRecord, dim string) string {
+	switch dim {
+	case "host":
+		return strings.SplitN(r.Path, "/", 2)[0]
+	case "major":
+		return semver.Major(r.Version)
+	case "delay":
+		// pseudo-version commit times and index timestamps are both UTC,
+		// so the offset between them is the ingestion delay, not a timezone
+		if !module.IsPseudoVersion(r.Version) {
+			return "release"
+		}
+		d, err := pseudoDelay(r)
+		if err != nil {
+			return "invalid"
+		}
+		return delayBucket(d)
+	}
+	return "all"
+}
+
+// delayBucket groups a commit to index delay into coarse ranges
+func delayBucket(d time.Duration) string {
+	switch {
+	case d < 0:
+		return "negative"
+	case d < time.Hour:
+		return "1h"
+	case d < 24*time.Hour:
+		return "1d"
+	case d < 7*24*time.Hour:
+		return "1w"
+	case d < 30*24*time.Hour:
+		return "30d"
+	}
+	return "older"
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// repoRoot is where the source of a module path lives
+type repoRoot struct {
+	// Method is how the root was found: known, general, meta or unresolved
+	Method string
+	VCS    string
+	Root   string
+	Repo   string
+}
+
+// vcsPaths mirrors the known hosts table of cmd/go/internal/vcs
+var vcsPaths = []struct {
+	prefix string
+	re     *regexp.Regexp
+	vcs    string
+}{
+	{"github.com/", regexp.MustCompile(`^(?P<root>github\.com/[A-Za-z0-9_.\-]+/[A-Za-z0-9_.\-]+)(/[A-Za-z0-9_.\-]+)*$`), "git"},
+	{"bitbucket.org/", regexp.MustCompile(`^(?P<root>bitbucket\.org/[A-Za-z0-9_.\-]+/[A-Za-z0-9_.\-]+)(/[A-Za-z0-9_.\-]+)*$`), "git"},
+	{"hub.jazz.net/git/", regexp.MustCompile(`^(?P<root>hub\.jazz\.net/git/[a-z0-9]+/[A-Za-z0-9_.\-]+)(/[A-Za-z0-9_.\-]+)*$`), "git"},
+	{"git.apache.org/", regexp.MustCompile(`^(?P<root>git\.apache\.org/[a-z0-9_.\-]+\.git)(/[A-Za-z0-9_.\-]+)*$`), "git"},
+	{"git.openstack.org/", regexp.MustCompile(`^(?P<root>git\.openstack\.org/[A-Za-z0-9_.\-]+/[A-Za-z0-9_.\-]+)(\.git)?(/[A-Za-z0-9_.\-]+)*$`), "git"},
+	{"chiselapp.com/", regexp.MustCompile(`^(?P<root>chiselapp\.com/user/[A-Za-z0-9]+/repository/[A-Za-z0-9_.\-]+)$`), "fossil"},
+	{"launchpad.net/", regexp.MustCompile(`^(?P<root>launchpad\.net/(([A-Za-z0-9_.\-]+)(/[A-Za-z0-9_.\-]+)?|~[A-Za-z0-9_.\-]+/(\+junk|[A-Za-z0-9_.\-]+)/[A-Za-z0-9_.\-]+))(/[A-Za-z0-9_.\-]+)*$`), "bzr"},
+}
+
+// vcsGeneral is the cmd/go syntax for paths naming their vcs, ex example.com/repo.git/pkg
+var vcsGeneral = regexp.MustCompile(`^(?P<root>(?P<repo>([a-z0-9.\-]+\.)+[a-z0-9.\-]+(:[0-9]+)?(/~?[A-Za-z0-9_.\-]+)+?)\.(?P<vcs>bzr|fossil|git|hg|svn))(/~?[A-Za-z0-9_.\-]+)*$`)
+
+// goimportTimeout bounds a request for a go-get=1 page,
+// aggregation is serial so a stalled server would hold up every report
+const goimportTimeout = 10 * time.Second
+
+// resolver finds repo roots for module paths, falling back to go-import meta tags
+// read from a directory of cached html (path with / replaced by --, .html)
+// or fetched from a stand-in server as {url}/{path}?go-get=1
+type resolver struct {
+	dir    string
+	url    string
+	client *http.Client
+
+	pages map[string][]metaImport
+}
+
+func newResolver(dir, url string) *resolver {
+	return &resolver{
+		dir:    dir,
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{Timeout: goimportTimeout},
+		pages:  make(map[string][]metaImport),
+	}
+}
+
+func (r *resolver) resolve(path string) (repoRoot, error) {
+	for _, vp := range vcsPaths {
+		if !strings.HasPrefix(path, vp.prefix) {
+			continue
+		}
+		m := vp.re.FindStringSubmatch(path)
+		if m == nil {
+			return repoRoot{Method: "unresolved"}, fmt.Errorf("resolve %s: invalid path for %s", path, vp.prefix)
+		}
+		return repoRoot{Method: "known", VCS: vp.vcs, Root: m[1], Repo: "https://" + m[1]}, nil
+	}
+	if m := vcsGeneral.FindStringSubmatch(path); m != nil {
+		return repoRoot{Method: "general", VCS: m[6], Root: m[1], Repo: m[2]}, nil
+	}
+
+	if r.dir == "" && r.url == "" {
+		return repoRoot{Method: "unresolved"}, nil
+	}
+	// like cmd/go, the page for a path may declare any prefix of it,
+	// only the full path is tried against the server
+	p := path
+	for {
+		mis, err := r.metaImports(p, p == path)
+		if err != nil {
+			return repoRoot{Method: "unresolved"}, fmt.Errorf("resolve %s: %w", path, err)
+		}
+		if mi, ok := matchMetaImport(mis, path); ok {
+			return repoRoot{Method: "meta", VCS: mi.VCS, Root: mi.Prefix, Repo: mi.RepoRoot}, nil
+		}
+		i := strings.LastIndex(p, "/")
+		if i < 0 {
+			return repoRoot{Method: "unresolved"}, nil
+		}
+		p = p[:i]
+	}
+}
+
+// metaImports returns the go-import tags for a path,
+// missing pages have none
+func (r *resolver) metaImports(path string, fetch bool) ([]metaImport, error) {
+	if mis, ok := r.pages[path]; ok {
+		return mis, nil
+	}
+
+	var rc io.ReadCloser
+	if r.dir != "" {
+		f, err := os.Open(filepath.Join(r.dir, strings.ReplaceAll(path, "/", "--")+".html"))
+		if err == nil {
+			rc = f
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("metaImports open %s: %w", path, err)
+		}
+	}
+	if rc == nil && fetch && r.url != "" {
+		res, err := r.client.Get(r.url + "/" + path + "?go-get=1")
+		if err != nil {
+			return nil, fmt.Errorf("metaImports get %s: %w", path, err)
+		}
+		if res.StatusCode == 200 {
+			rc = res.Body
+		} else {
+			res.Body.Close()
+		}
+	}
+	if rc == nil {
+		r.pages[path] = nil
+		return nil, nil
+	}
+	defer rc.Close()
+
+	mis, err := parseMetaGoImports(rc)
+	if err != nil {
+		return nil, fmt.Errorf("metaImports parse %s: %w", path, err)
+	}
+	r.pages[path] = mis
+	return mis, nil
+}
+
+type metaImport struct {
+	Prefix, VCS, RepoRoot string
+}
+
+// matchMetaImport picks the import declaring a prefix of path,
+// preferring vcs entries over mod (proxy) entries
+func matchMetaImport(mis []metaImport, path string) (metaImport, bool) {
+	var match metaImport
+	var ok bool
+	for _, mi := range mis {
+		if mi.Prefix != path && !strings.HasPrefix(path, mi.Prefix+"/") {
+			continue
+		}
+		if !ok || (match.VCS == "mod" && mi.VCS != "mod") {
+			match, ok = mi, true
+		}
+	}
+	return match, ok
+}
+
+// parseMetaGoImports reads <meta name="go-import" content="prefix vcs repo"> tags
+// from the head of an html document, as in cmd/go
+func parseMetaGoImports(r io.Reader) ([]metaImport, error) {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		switch strings.ToLower(charset) {
+		case "utf-8", "ascii":
+			return input, nil
+		}
+		return nil, fmt.Errorf("can't decode XML document using charset %q", charset)
+	}
+	d.Strict = false
+
+	var imports []metaImport
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			if err == io.EOF || len(imports) > 0 {
+				return imports, nil
+			}
+			return nil, err
+		}
+		if e, ok := t.(xml.StartElement); ok && strings.EqualFold(e.Name.Local, "body") {
+			return imports, nil
+		}
+		if e, ok := t.(xml.EndElement); ok && strings.EqualFold(e.Name.Local, "head") {
+			return imports, nil
+		}
+		e, ok := t.(xml.StartElement)
+		if !ok || !strings.EqualFold(e.Name.Local, "meta") {
+			continue
+		}
+		if attrValue(e.Attr, "name") != "go-import" {
+			continue
+		}
+		if f := strings.Fields(attrValue(e.Attr, "content")); len(f) == 3 {
+			imports = append(imports, metaImport{Prefix: f[0], VCS: f[1], RepoRoot: f[2]})
+		}
+	}
+}
+
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// repo is the repo root of a module path,
+// falling back to the module family for unresolved paths
+func (r *resolver) repo(path string) string {
+	rr, err := r.resolve(path)
+	if err != nil || rr.Root == "" {
+		f, _ := family(path)
+		return f
+	}
+	return rr.Root
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMetaGoImports(t *testing.T) {
+	tests := []struct {
+		name, html string
+		want       []metaImport
+	}{
+		{
+			"one",
+			`<html><head><meta name="go-import" content="example.com/a git https://git.example.com/a"></head></html>`,
+			[]metaImport{{"example.com/a", "git", "https://git.example.com/a"}},
+		}, {
+			"mod and vcs, other meta tags",
+			`<!doctype html><html><head>
+<meta charset="utf-8">
+<meta name="go-source" content="example.com/a _ _ _">
+<META NAME="go-import" CONTENT="example.com/a mod https://proxy.example.com">
+<meta name="go-import" content="example.com/a   hg   https://hg.example.com/a">
+</head></html>`,
+			[]metaImport{
+				{"example.com/a", "mod", "https://proxy.example.com"},
+				{"example.com/a", "hg", "https://hg.example.com/a"},
+			},
+		}, {
+			"wrong field count",
+			`<head><meta name="go-import" content="example.com/a git"></head>`,
+			nil,
+		}, {
+			"stops at body",
+			`<head></head><body><meta name="go-import" content="example.com/a git https://x"></body>`,
+			nil,
+		}, {
+			"no head, unclosed tags",
+			`<meta name="go-import" content="example.com/a git https://x"><p>text`,
+			[]metaImport{{"example.com/a", "git", "https://x"}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseMetaGoImports(strings.NewReader(tt.html))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchMetaImport(t *testing.T) {
+	mod := metaImport{"example.com/a", "mod", "https://proxy.example.com"}
+	git := metaImport{"example.com/a", "git", "https://git.example.com/a"}
+	sub := metaImport{"example.com/a/b", "git", "https://git.example.com/b"}
+	tests := []struct {
+		mis  []metaImport
+		path string
+		want metaImport
+		ok   bool
+	}{
+		{[]metaImport{git}, "example.com/a", git, true},
+		{[]metaImport{git}, "example.com/a/b/c", git, true},
+		{[]metaImport{git}, "example.com/ab", metaImport{}, false},
+		{[]metaImport{git}, "example.com", metaImport{}, false},
+		{[]metaImport{mod, git}, "example.com/a", git, true},
+		{[]metaImport{git, mod}, "example.com/a", git, true},
+		{[]metaImport{mod}, "example.com/a", mod, true},
+		{[]metaImport{sub, git}, "example.com/a/c", git, true},
+		{nil, "example.com/a", metaImport{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := matchMetaImport(tt.mis, tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("matchMetaImport(%v, %s) = %v, %v, want %v, %v", tt.mis, tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	for path, content := range map[string]string{
+		"vanity.example/a":   "vanity.example/a git https://git.example/a",
+		"vanity.example/m/x": "vanity.example/m/x mod https://proxy.example",
+	} {
+		html := `<head><meta name="go-import" content="` + content + `"></head>`
+		err := os.WriteFile(filepath.Join(dir, strings.ReplaceAll(path, "/", "--")+".html"), []byte(html), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := newResolver(dir, "")
+
+	tests := []struct {
+		path string
+		want repoRoot
+		err  bool
+	}{
+		{"github.com/a/b/v2", repoRoot{"known", "git", "github.com/a/b", "https://github.com/a/b"}, false},
+		{"github.com/a", repoRoot{Method: "unresolved"}, true},
+		{"example.com/repo.git/pkg", repoRoot{"general", "git", "example.com/repo.git", "example.com/repo"}, false},
+		// the page of a prefix of the path declares it
+		{"vanity.example/a/b/c", repoRoot{"meta", "git", "vanity.example/a", "https://git.example/a"}, false},
+		{"vanity.example/m/x", repoRoot{"meta", "mod", "vanity.example/m/x", "https://proxy.example"}, false},
+		{"vanity.example/other", repoRoot{Method: "unresolved"}, false},
+	}
+	for _, tt := range tests {
+		got, err := r.resolve(tt.path)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("resolve(%s) = %+v, %v, want %+v", tt.path, got, err, tt.want)
+		}
+	}
+
+	if got := newResolver("", "").repo("vanity.example/a/v2"); got != "vanity.example/a" {
+		t.Errorf("repo without pages = %s, want the module family", got)
+	}
+}